@@ -0,0 +1,74 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessLog makes the router write a line in the Combined Log Format to w
+// after each request it serves:
+//
+//	192.0.2.1 - alice [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/5.0"
+//
+// The remote address is the one determined by the router's ClientIP settings,
+// as returned by ClientIP to handlers. Every request is logged, including
+// those answered before matching, such as redirects. Lines are written
+// whole, one at a time. A nil w disables the log.
+func (r *Router) AccessLog(w io.Writer) {
+	r.accessLog.Store(logWriter{w})
+}
+
+// logWriter wraps the access log writer, so that it can be stored in an
+// atomic.Value whatever its type, or nil.
+type logWriter struct {
+	io.Writer
+}
+
+// logAccess writes the access log line of a request served at start.
+func (r *Router) logAccess(req *http.Request, rw *responseWriter, start time.Time) {
+	log, _ := r.accessLog.Load().(logWriter)
+	if log.Writer == nil {
+		return
+	}
+	user := "-"
+	if name, _, ok := req.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	uri := req.RequestURI
+	if uri == "" {
+		uri = req.URL.RequestURI()
+	}
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	size := "-"
+	if rw.written > 0 {
+		size = strconv.FormatInt(rw.written, 10)
+	}
+	line := []string{
+		r.clientIP(req), "-", user,
+		"[" + start.Format("02/Jan/2006:15:04:05 -0700") + "]",
+		strconv.Quote(req.Method + " " + uri + " " + req.Proto),
+		strconv.Itoa(status), size,
+		logField(req.Referer()), logField(req.UserAgent()),
+	}
+	r.accessLogMu.Lock()
+	io.WriteString(log, strings.Join(line, " ")+"\n")
+	r.accessLogMu.Unlock()
+}
+
+// logField returns s quoted for the access log, or "-" quoted if empty.
+func logField(s string) string {
+	if s == "" {
+		s = "-"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,56 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	r := New()
+	r.AccessLog(&buf)
+	r.Get("/hello/{name}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello, " + req.URL.Query().Get(":name")))
+	})
+
+	req := httptest.NewRequest("GET", "/hello/world?x=1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.SetBasicAuth("alice", "secret")
+	req.Header.Set("Referer", "http://example.com/")
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("POST", "/missing", nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := regexp.MustCompile(`^` +
+		`192\.0\.2\.1 - alice \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hello/world\?x=1 HTTP/1\.1" 200 12 "http://example\.com/" "test-agent/1\.0"\n` +
+		`192\.0\.2\.2 - - \[[^\]]+\] "POST /missing HTTP/1\.1" 404 19 "-" "-"\n$`)
+	if !lines.MatchString(buf.String()) {
+		t.Errorf("Unexpected access log:\n%s", buf.String())
+	}
+
+	// Responses sent before matching are logged as well.
+	r.MaxSegments = 3
+	for _, test := range []struct {
+		path string
+		code string
+	}{
+		{"/x//y", "301"},
+		{"/a/b/c/d", "414"},
+	} {
+		buf.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if want := `"GET ` + test.path + ` HTTP/1.1" ` + test.code + ` `; !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("%s: expected a log line containing %q, got %q", test.path, want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Client returns an HTTP client whose requests are served directly by the
+// router, without going through the network. It exercises the whole router,
+// including middleware and redirects, which makes it convenient for tests:
+//
+//	resp, err := r.Client().Get("http://example.com/products/1")
+func (r *Router) Client() *http.Client {
+	return &http.Client{Transport: transport{r}}
+}
+
+// transport is an http.RoundTripper that dispatches requests to a router.
+type transport struct {
+	router *Router
+}
+
+// RoundTrip serves req with the router and returns the buffered response.
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The router may change the request, which the client still owns.
+	sreq := *req
+	u := *req.URL
+	sreq.URL = &u
+	sreq.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		sreq.Header[k] = append([]string(nil), v...)
+	}
+	sreq.RequestURI = req.URL.RequestURI()
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+	if sreq.RemoteAddr == "" {
+		sreq.RemoteAddr = "127.0.0.1:0"
+	}
+	b := newResponseBuffer()
+	t.router.ServeHTTP(b, &sreq)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", b.status, http.StatusText(b.status)),
+		StatusCode:    b.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        b.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(b.body.Bytes())),
+		ContentLength: int64(b.body.Len()),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	r := New()
+	r.Get("/a/{b}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("b=" + req.URL.Query().Get(":b")))
+	})
+
+	resp, err := r.Client().Get("http://example.com/a/y/../x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "b=x" {
+		t.Errorf("Expected redirect to be followed, got %d (%q)", resp.StatusCode, body)
+	}
+	if path := resp.Request.URL.Path; path != "/a/x" {
+		t.Errorf("Expected final path %q, got %q", "/a/x", path)
+	}
+}
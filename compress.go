@@ -0,0 +1,162 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NoCompress exempts the routes with the given pattern from compression by
+// CompressMiddleware, e.g. routes serving already compressed or
+// range-sensitive content.
+func (r *Router) NoCompress(pat string) {
+	if r.noCompress == nil {
+		r.noCompress = make(map[string]bool)
+	}
+	r.noCompress[pat] = true
+}
+
+// CompressMiddleware is a middleware that gzips the responses to clients
+// accepting it, except for the routes exempted with NoCompress:
+//
+//	r.Use(r.CompressMiddleware)
+func (r *Router) CompressMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.noCompress[currentPattern(req)] || !acceptsGzip(req) {
+			h.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w, sniff: r.DefaultContentType == ""}
+		defer gw.close()
+		h.ServeHTTP(gw, req)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of req allows gzip.
+func acceptsGzip(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		if coding := strings.TrimSpace(params[0]); coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		return q > 0
+	}
+	return false
+}
+
+// gzipResponseWriter is an http.ResponseWriter that gzips the response body,
+// unless the handler set a Content-Encoding itself. The header is held back
+// until the first body bytes are written, so that the Content-Type can be
+// sniffed from the uncompressed bytes.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+	// sniff makes the writer detect a missing Content-Type. It is unset when
+	// the router applies a DefaultContentType instead.
+	sniff bool
+	// status is the status code of the response, once set by the handler.
+	status      int
+	wroteHeader bool
+}
+
+// WriteHeader records the status code of the response, to be sent with the
+// header on the first write.
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write writes p to the response body, compressed if needed.
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if w.sniff && w.Header().Get("Content-Type") == "" && bodyAllowed(w.status) {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.writeHeader(true)
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// writeHeader sends the response header, switching it to gzip encoding if
+// compress is set and the response has a body.
+func (w *gzipResponseWriter) writeHeader(compress bool) {
+	w.wroteHeader = true
+	h := w.Header()
+	if compress && h.Get("Content-Encoding") == "" && bodyAllowed(w.status) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// Flush sends any buffered data to the client, if supported.
+func (w *gzipResponseWriter) Flush() {
+	if !w.wroteHeader {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.writeHeader(true)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, if supported.
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("pat: response does not implement http.Hijacker")
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close sends the header of a response without body, uncompressed, and
+// terminates the gzip stream, if any.
+func (w *gzipResponseWriter) close() {
+	if !w.wroteHeader && w.status != 0 {
+		w.writeHeader(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNoCompress(t *testing.T) {
+	h := func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello, world"))
+	}
+	r := New()
+	r.Use(r.CompressMiddleware)
+	r.NoCompress("/video/{id}")
+	r.Get("/data", h)
+	r.Get("/video/{id}", h)
+
+	tests := []struct {
+		path, acceptEncoding string
+		gzipped              bool
+	}{
+		{"/data", "gzip, deflate", true},
+		{"/data", "", false},
+		{"/data", "gzip;q=0", false},
+		{"/video/1", "gzip", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if gzipped := w.Header().Get("Content-Encoding") == "gzip"; gzipped != test.gzipped {
+			t.Errorf("%s (Accept-Encoding %q): expected gzipped %v, got %v", test.path, test.acceptEncoding, test.gzipped, gzipped)
+			continue
+		}
+		body := w.Body.String()
+		if test.gzipped {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Errorf("%s: invalid gzip body: %v", test.path, err)
+				continue
+			}
+			b, _ := ioutil.ReadAll(zr)
+			body = string(b)
+		}
+		if body != "hello, world" {
+			t.Errorf("%s (Accept-Encoding %q): unexpected body %q", test.path, test.acceptEncoding, body)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			t.Errorf("%s (Accept-Encoding %q): expected sniffed Content-Type, got %q", test.path, test.acceptEncoding, ct)
+		}
+	}
+}
+
+func TestCompressContentType(t *testing.T) {
+	tests := []struct {
+		defaultType string
+		h           http.HandlerFunc
+		contentType string
+	}{
+		{"", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("<html><body>hi</body></html>"))
+		}, "text/html; charset=utf-8"},
+		{"application/json", func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(`{"a":1}`))
+		}, "application/json"},
+		{"application/json", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("a,b"))
+		}, "text/csv"},
+	}
+	for _, test := range tests {
+		r := New()
+		r.DefaultContentType = test.defaultType
+		r.Use(r.CompressMiddleware)
+		r.Get("/", test.h)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Errorf("Default %q: expected gzipped response", test.defaultType)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("Default %q: expected Content-Type %q, got %q", test.defaultType, test.contentType, ct)
+		}
+	}
+
+	// A response without body is sent uncompressed.
+	r := New()
+	r.Use(r.CompressMiddleware)
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Errorf("Empty response: expected uncompressed 202, got %d (%q, %d bytes)", w.Code, w.Header().Get("Content-Encoding"), w.Body.Len())
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// contextKey is the type of the request context keys used by this package.
+type contextKey int
+
+const (
+	varsKey contextKey = iota
+	mediaTypeKey
+	routeKey
+	scopesKey
+	bearerKey
+	clientIPKey
+	patternKey
+)
+
+// Var is a route variable captured from the request path.
+type Var struct {
+	Name, Value string
+}
+
+// withVars returns a shallow copy of req carrying the ordered route
+// variables in its context.
+func withVars(req *http.Request, vars []Var) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), varsKey, vars))
+}
+
+// OrderedVars returns the route variables of the request in the order their
+// placeholders appear in the pattern of the matched route, e.g. x then y for
+// "/a/{x}/b/{y}". Unlike the URL query, it only contains captured values.
+func OrderedVars(r *http.Request) []Var {
+	vars, _ := r.Context().Value(varsKey).([]Var)
+	return vars
+}
+
+// withMediaType returns a shallow copy of req carrying the negotiated media
+// type in its context.
+func withMediaType(req *http.Request, mediaType string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), mediaTypeKey, mediaType))
+}
+
+// NegotiatedType returns the media type negotiated for a route registered
+// with AddProduces, or "" if there is none.
+func NegotiatedType(r *http.Request) string {
+	mediaType, _ := r.Context().Value(mediaTypeKey).(string)
+	return mediaType
+}
+
+// withRoute returns a shallow copy of req carrying the matched route and the
+// pattern it was registered for in its context.
+func withRoute(req *http.Request, route *mux.Route, pattern string) *http.Request {
+	ctx := context.WithValue(req.Context(), routeKey, route)
+	return req.WithContext(context.WithValue(ctx, patternKey, pattern))
+}
+
+// currentPattern returns the pattern the matched route of the request was
+// registered for, or "" if there is none.
+func currentPattern(r *http.Request) string {
+	pattern, _ := r.Context().Value(patternKey).(string)
+	return pattern
+}
+
+// CurrentRoute returns the route matched for the request, or nil if there is
+// none.
+func CurrentRoute(r *http.Request) *mux.Route {
+	route, _ := r.Context().Value(routeKey).(*mux.Route)
+	return route
+}
+
+// WithScopes returns a shallow copy of r granted the given scopes, for use by
+// authentication middleware in front of the router.
+func WithScopes(r *http.Request, scopes ...string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), scopesKey, scopes))
+}
+
+// Scopes returns the scopes granted to the request with WithScopes.
+func Scopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(scopesKey).([]string)
+	return scopes
+}
+
+// withBearerToken returns a shallow copy of req carrying the bearer token in
+// its context.
+func withBearerToken(req *http.Request, token string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), bearerKey, token))
+}
+
+// BearerToken returns the bearer token of a request served by a route
+// registered with RequireBearer, or "" if there is none.
+func BearerToken(r *http.Request) string {
+	token, _ := r.Context().Value(bearerKey).(string)
+	return token
+}
+
+// withClientIP returns a shallow copy of req carrying the client IP in its
+// context.
+func withClientIP(req *http.Request, ip string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), clientIPKey, ip))
+}
+
+// ClientIP returns the IP address of the client that made the request, as
+// determined by the router's ClientIP function. For requests not served by a
+// router, the host part of RemoteAddr is returned.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
@@ -0,0 +1,87 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	gcontext "github.com/gorilla/context"
+)
+
+func TestOrderedVars(t *testing.T) {
+	var vars []Var
+	r := New()
+	r.Get("/a/{x}/b/{y:[0-9]+}", func(w http.ResponseWriter, req *http.Request) {
+		vars = OrderedVars(req)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a/foo/b/42", nil))
+	expected := []Var{{Name: "x", Value: "foo"}, {Name: "y", Value: "42"}}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Expected vars %v, got %v", expected, vars)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		trust     bool
+		forwarded string
+		ip        string
+	}{
+		{false, "", "192.0.2.1"},
+		{false, "203.0.113.7", "192.0.2.1"},
+		{true, "", "192.0.2.1"},
+		{true, "203.0.113.7, 198.51.100.2", "203.0.113.7"},
+	}
+	for _, test := range tests {
+		var ip string
+		r := New()
+		r.TrustForwardedFor = test.trust
+		r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+			ip = ClientIP(req)
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if ip != test.ip {
+			t.Errorf("trust %v, X-Forwarded-For %q: expected %q, got %q", test.trust, test.forwarded, test.ip, ip)
+		}
+	}
+
+	var ip string
+	r := New()
+	r.ClientIP = func(req *http.Request) string { return req.Header.Get("X-Real-IP") }
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		ip = ClientIP(req)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Real-IP", "198.51.100.9")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if ip != "198.51.100.9" {
+		t.Errorf("Custom ClientIP: expected %q, got %q", "198.51.100.9", ip)
+	}
+}
+
+func TestClearContext(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		var handlerReq *http.Request
+		r := New()
+		r.KeepContext = keep
+		r.Get("/plain", func(w http.ResponseWriter, req *http.Request) {
+			handlerReq = req
+			gcontext.Set(req, "k", "v")
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/plain", nil))
+		if _, ok := gcontext.GetOk(handlerReq, "k"); ok != keep {
+			t.Errorf("KeepContext %v: expected value kept %v, got %v", keep, keep, ok)
+		}
+		gcontext.Clear(handlerReq)
+	}
+}
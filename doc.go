@@ -25,7 +25,8 @@ one of the paths, the corresponding handler is called passing
 (http.ResponseWriter, *http.Request) as parameters.
 
 Note: gorilla/pat matches path prefixes, so you must register the most
-specific paths first.
+specific paths first. To match a whole path only, use the Exact() method;
+exact routes take precedence over prefix routes.
 
 Note: differently from pat, these methods accept a handler function, and not an
 http.Handler. We think this is shorter and more convenient. To set an
@@ -0,0 +1,477 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"hash/fnv"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
+)
+
+// SingleFlight registers a pattern with a handler for the given request
+// method, coalescing concurrent requests with the same key so that the
+// handler runs once and its response is shared by all of them. The key is
+// computed by keyFn; if it is nil, the request method, path and query are
+// used, without the route variables.
+//
+// This is only sensible for idempotent, cacheable requests such as GET.
+func (r *Router) SingleFlight(meth, pat string, keyFn func(*http.Request) string, h http.HandlerFunc) *mux.Route {
+	if keyFn == nil {
+		keyFn = singleFlightKey
+	}
+	var group singleflight.Group
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		v, _, _ := group.Do(keyFn(req), func() (interface{}, error) {
+			b := newResponseBuffer()
+			h(b, req)
+			return b, nil
+		})
+		v.(*responseBuffer).writeTo(w)
+	}))
+}
+
+// singleFlightKey returns the default SingleFlight key of the request: its
+// method, path and query, leaving out the route variables injected in the
+// query, whose order varies.
+func singleFlightKey(req *http.Request) string {
+	query := req.URL.Query()
+	for key := range query {
+		if strings.HasPrefix(key, ":") {
+			delete(query, key)
+		}
+	}
+	return req.Method + " " + req.URL.Path + "?" + query.Encode()
+}
+
+// AddResponseTimeout registers a pattern with a handler for the given request
+// method that must produce its full response within d. Otherwise the client
+// gets a 503 Service Unavailable with the router's TimeoutMessage, and the
+// request context is canceled.
+//
+// As with http.TimeoutHandler, the response is buffered in memory until the
+// handler returns, so it can't be streamed and the connection can't be
+// hijacked. Handlers that need that should watch the request context for a
+// deadline instead.
+func (r *Router) AddResponseTimeout(meth, pat string, d time.Duration, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The message is read per request, like the other router settings.
+		http.TimeoutHandler(h, d, r.TimeoutMessage).ServeHTTP(w, req)
+	}))
+}
+
+// AddSecure registers a pattern with a handler for the given request method
+// that is only served over HTTPS. Plain HTTP GET and HEAD requests are
+// redirected to their HTTPS URL; other plain HTTP requests get a 403
+// Forbidden, since redirecting them would lose the request body.
+//
+// Requests are considered secure when made over TLS or, if the router's
+// TrustForwardedProto is set, when their X-Forwarded-Proto header is "https".
+// The scheme of the request URL, which the client controls, is ignored.
+func (r *Router) AddSecure(meth, pat string, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil || r.TrustForwardedProto && req.Header.Get("X-Forwarded-Proto") == "https" {
+			h(w, req)
+			return
+		}
+		if req.Method != "GET" && req.Method != "HEAD" {
+			http.Error(w, "HTTPS required", http.StatusForbidden)
+			return
+		}
+		// Use the original request URI, without the route variables.
+		u, err := url.ParseRequestURI(req.RequestURI)
+		if err != nil {
+			c := *req.URL
+			u = &c
+		}
+		u.Scheme, u.Host = "https", req.Host
+		http.Redirect(w, req, u.String(), http.StatusMovedPermanently)
+	}))
+}
+
+// AddConcurrencyLimit registers a pattern with a handler for the given request
+// method that runs at most max times simultaneously. Requests over the limit
+// get a 503 Service Unavailable instead of waiting. It panics if max is not
+// positive.
+func (r *Router) AddConcurrencyLimit(meth, pat string, max int, h http.HandlerFunc) *mux.Route {
+	if max <= 0 {
+		panic("pat: AddConcurrencyLimit requires a positive limit, got " + strconv.Itoa(max))
+	}
+	sem := make(chan struct{}, max)
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			h(w, req)
+		default:
+			http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+		}
+	}))
+}
+
+// AddProduces registers a pattern with a handler for the given request method
+// that produces the given media types, in order of preference. Requests whose
+// Accept header allows none of them get a 406 Not Acceptable; otherwise the
+// negotiated media type is available to the handler via NegotiatedType.
+func (r *Router) AddProduces(meth, pat string, produces []string, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mediaType := negotiate(req.Header.Get("Accept"), produces)
+		if mediaType == "" {
+			http.Error(w, "not acceptable", http.StatusNotAcceptable)
+			return
+		}
+		h(w, withMediaType(req, mediaType))
+	}))
+}
+
+// negotiate returns the offered media type with the highest quality in the
+// Accept header, or "" if none is acceptable. On ties, the first offer wins.
+func negotiate(accept string, offers []string) string {
+	if accept == "" && len(offers) > 0 {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality given to a media type by the most
+// specific matching media range of the Accept header, or 0 if none matches.
+func acceptQuality(accept, mediaType string) float64 {
+	mediaType, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return 0
+	}
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		var s int
+		switch {
+		case mediaRange == mediaType:
+			s = 2
+		case mediaRange == "*/*":
+			s = 0
+		case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, mediaRange[:len(mediaRange)-1]):
+			s = 1
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = 1, s
+			if v, ok := params["q"]; ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+	}
+	return q
+}
+
+// RequireScopes sets the scopes required by the routes with the given
+// pattern. They are enforced by ScopeMiddleware, which must be installed
+// with Use.
+func (r *Router) RequireScopes(pat string, scopes ...string) {
+	if r.scopes == nil {
+		r.scopes = make(map[string][]string)
+	}
+	r.scopes[pat] = scopes
+}
+
+// ScopeMiddleware is a middleware that responds with a 403 Forbidden when the
+// request was not granted, with WithScopes, every scope required for the
+// matched route by RequireScopes:
+//
+//	r.Use(r.ScopeMiddleware)
+func (r *Router) ScopeMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		granted := make(map[string]bool)
+		for _, scope := range Scopes(req) {
+			granted[scope] = true
+		}
+		for _, scope := range r.scopes[currentPattern(req)] {
+			if !granted[scope] {
+				http.Error(w, "insufficient scope", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// AddSharded registers a pattern with several handlers for the given request
+// method, serving each request with the shard picked by a stable hash of
+// keyFn(req), so that requests with the same key always reach the same
+// handler. It panics if there are no shards.
+func (r *Router) AddSharded(meth, pat string, shards []http.HandlerFunc, keyFn func(*http.Request) string) *mux.Route {
+	if len(shards) == 0 {
+		panic("pat: AddSharded requires at least one shard")
+	}
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		shards[shardIndex(keyFn(req), len(shards))](w, req)
+	}))
+}
+
+// shardIndex returns the shard of n for the given key.
+func shardIndex(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// AddHeaderAbsent registers a pattern with a handler for the given request
+// method that only matches requests without the named header, e.g. to serve
+// requests lacking an Authorization header anonymously. It complements the
+// Headers matcher of the returned route.
+func (r *Router) AddHeaderAbsent(meth, pat, headerName string, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, h).MatcherFunc(func(req *http.Request, match *mux.RouteMatch) bool {
+		_, ok := req.Header[http.CanonicalHeaderKey(headerName)]
+		return !ok
+	})
+}
+
+// AddDepth registers a handler for the given request method that matches
+// any path with exactly depth segments, whatever their values, e.g. "/a/b"
+// for a depth of 2. Segments are counted on the cleaned path, ignoring a
+// trailing slash; the root path has a depth of 0.
+func (r *Router) AddDepth(meth string, depth int, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, "/", h).MatcherFunc(func(req *http.Request, match *mux.RouteMatch) bool {
+		return pathDepth(cleanPath(req.URL.Path)) == depth
+	})
+}
+
+// pathDepth returns the number of segments of the path p.
+func pathDepth(p string) int {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return 0
+	}
+	return strings.Count(p, "/") + 1
+}
+
+// AddMinTLS registers a pattern with a handler for the given request method
+// that is only served over TLS connections negotiated with at least the given
+// version, such as tls.VersionTLS12. Other requests, including plain HTTP
+// ones, get a 403 Forbidden.
+func (r *Router) AddMinTLS(meth, pat string, minVersion uint16, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || req.TLS.Version < minVersion {
+			http.Error(w, "TLS version not allowed", http.StatusForbidden)
+			return
+		}
+		h(w, req)
+	}))
+}
+
+// AddDefaultQuery registers a pattern with a handler for the given request
+// method, adding the default query values for the keys the client did not
+// supply, e.g. pagination defaults. The route variables in the query are
+// left untouched.
+func (r *Router) AddDefaultQuery(meth, pat string, defaults url.Values, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		missing := make(url.Values)
+		for key, values := range defaults {
+			if _, ok := q[key]; !ok {
+				missing[key] = values
+			}
+		}
+		if len(missing) > 0 {
+			if req.URL.RawQuery == "" {
+				req.URL.RawQuery = missing.Encode()
+			} else {
+				req.URL.RawQuery += "&" + missing.Encode()
+			}
+		}
+		h(w, req)
+	}))
+}
+
+// CachedResponse is a response kept by an IdempotencyStore.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore keeps the responses of requests made with an
+// Idempotency-Key header, e.g. in memory or in Redis.
+type IdempotencyStore interface {
+	// Get returns the response stored for key, if any.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores the response for key.
+	Set(key string, resp *CachedResponse)
+}
+
+// RequireIdempotencyKey registers a pattern with a handler for the given
+// request method that requires an Idempotency-Key header on mutating requests
+// (POST, PUT, PATCH and DELETE), responding with a 400 Bad Request when it is
+// missing. The response to the first request with a key is kept in store and
+// replayed for later requests with the same key, without running the handler
+// again. Server errors are not kept, so that the request can be retried.
+//
+// Keys are scoped to the route: they are stored as the request method, the
+// pattern and the header value separated by spaces, e.g.
+// "POST /payments abc", so that a store can be shared by several routes.
+//
+// Concurrent requests with the same key may both run the handler; stores
+// that need to prevent it must reserve keys themselves.
+func (r *Router) RequireIdempotencyKey(meth, pat string, store IdempotencyStore, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case "POST", "PUT", "PATCH", "DELETE":
+		default:
+			h(w, req)
+			return
+		}
+		key := req.Header.Get("Idempotency-Key")
+		if key == "" {
+			http.Error(w, "missing Idempotency-Key header", http.StatusBadRequest)
+			return
+		}
+		key = req.Method + " " + pat + " " + key
+		if resp, ok := store.Get(key); ok {
+			b := newResponseBuffer()
+			b.header, b.status = resp.Header, resp.Status
+			b.body.Write(resp.Body)
+			b.writeTo(w)
+			return
+		}
+		b := newResponseBuffer()
+		h(b, req)
+		if b.status == 0 {
+			b.status = http.StatusOK
+		}
+		if b.status < 500 {
+			store.Set(key, &CachedResponse{
+				Status: b.status,
+				Header: b.header,
+				Body:   b.body.Bytes(),
+			})
+		}
+		b.writeTo(w)
+	}))
+}
+
+// RequireBearer registers a pattern with a handler for the given request
+// method that is only served to requests with a well-formed bearer token in
+// their Authorization header ("Bearer <token>"). The token is not validated;
+// the handler gets it with BearerToken. Other requests get a 401
+// Unauthorized with a WWW-Authenticate challenge.
+func (r *Router) RequireBearer(meth, pat string, h http.HandlerFunc) *mux.Route {
+	return r.Add(meth, pat, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		if auth == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		token, ok := parseBearer(auth)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+			http.Error(w, "malformed bearer token", http.StatusUnauthorized)
+			return
+		}
+		h(w, withBearerToken(req, token))
+	}))
+}
+
+// parseBearer returns the token of a "Bearer <token>" Authorization header,
+// with the token in the b64token syntax of RFC 6750.
+func parseBearer(auth string) (string, bool) {
+	const prefix = "bearer "
+	if len(auth) <= len(prefix) || strings.ToLower(auth[:len(prefix)]) != prefix {
+		return "", false
+	}
+	token := auth[len(prefix):]
+	end := strings.TrimRight(token, "=")
+	if end == "" {
+		return "", false
+	}
+	for _, c := range end {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.ContainsRune("-._~+/", c):
+		default:
+			return "", false
+		}
+	}
+	return token, true
+}
+
+// WebSocket registers a pattern with a handler for WebSocket upgrade
+// requests: GET requests with "Connection: Upgrade" and "Upgrade: websocket"
+// headers. Plain GET requests to the same path are left to other routes. The
+// handler is expected to hijack the connection, which the router's response
+// writer supports.
+func (r *Router) WebSocket(pat string, h http.HandlerFunc) *mux.Route {
+	return r.Get(pat, h).MatcherFunc(func(req *http.Request, match *mux.RouteMatch) bool {
+		return headerContainsToken(req.Header, "Connection", "upgrade") &&
+			headerContainsToken(req.Header, "Upgrade", "websocket")
+	})
+}
+
+// headerContainsToken reports whether the comma-separated values of the named
+// header contain the given token, compared case-insensitively.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deprecation holds the settings of a route marked by Deprecate.
+type deprecation struct {
+	sunset    time.Time
+	successor string
+}
+
+// Deprecate marks the routes with the given pattern as deprecated, to be
+// removed at sunset and replaced by the successor URL. Their responses are
+// given Deprecation, Sunset and Link headers by DeprecationMiddleware, which
+// must be installed with Use. A zero sunset or empty successor omits the
+// corresponding header.
+func (r *Router) Deprecate(pat string, sunset time.Time, successor string) {
+	if r.deprecations == nil {
+		r.deprecations = make(map[string]deprecation)
+	}
+	r.deprecations[pat] = deprecation{sunset: sunset, successor: successor}
+}
+
+// DeprecationMiddleware is a middleware that sets the deprecation headers of
+// the routes marked by Deprecate:
+//
+//	r.Use(r.DeprecationMiddleware)
+func (r *Router) DeprecationMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if d, ok := r.deprecations[currentPattern(req)]; ok {
+			w.Header().Set("Deprecation", "true")
+			if !d.sunset.IsZero() {
+				w.Header().Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.successor != "" {
+				w.Header().Add("Link", "<"+d.successor+`>; rel="successor-version"`)
+			}
+		}
+		h.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,594 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlight(t *testing.T) {
+	const n = 10
+	var calls int32
+	r := New()
+	r.SingleFlight("GET", "/report/{id}", nil, func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// Hold the flight until every request is waiting on it.
+		for inSingleFlight() < n {
+			runtime.Gosched()
+		}
+		w.Write([]byte("report"))
+	})
+
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/report/1/2/3", nil))
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", calls)
+	}
+	for i, body := range bodies {
+		if body != "report" {
+			t.Errorf("Expected shared response for request %d, got %q", i, body)
+		}
+	}
+}
+
+// inSingleFlight returns the number of goroutines inside a singleflight call.
+func inSingleFlight() int {
+	buf := make([]byte, 1<<20)
+	return strings.Count(string(buf[:runtime.Stack(buf, true)]), "singleflight.(*Group).Do(")
+}
+
+func TestSingleFlightKey(t *testing.T) {
+	keys := make(map[string]bool)
+	r := New()
+	r.Get("/x/{a}/{b}/{c}", func(w http.ResponseWriter, req *http.Request) {
+		keys[singleFlightKey(req)] = true
+	})
+	for i := 0; i < 50; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x/1/2/3?q=v", nil))
+	}
+	if want := "GET /x/1/2/3?q=v"; len(keys) != 1 || !keys[want] {
+		t.Errorf("Expected the single key %q, got %v", want, keys)
+	}
+}
+
+func TestAddResponseTimeout(t *testing.T) {
+	r := New()
+	r.AddResponseTimeout("GET", "/slow", 10*time.Millisecond, func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte("done"))
+	})
+	// The message may be set after the route is registered.
+	r.TimeoutMessage = "too slow"
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "too slow" {
+		t.Errorf("Expected 503 with timeout message, got %d (%q)", w.Code, w.Body.String())
+	}
+}
+
+func TestAddSecure(t *testing.T) {
+	r := New()
+	r.AddSecure("GET", "/account", myHandler)
+	r.AddSecure("POST", "/account", myHandler)
+
+	tests := []struct {
+		meth, url string
+		code      int
+		location  string
+	}{
+		{"GET", "https://example.com/account", http.StatusOK, ""},
+		{"GET", "http://example.com/account?tab=1", http.StatusMovedPermanently, "https://example.com/account?tab=1"},
+		{"POST", "http://example.com/account", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.meth, test.url, nil))
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s: expected %d (%q), got %d (%q)", test.meth, test.url, test.code, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// An absolute-form request line naming https does not make a plain
+	// HTTP request secure.
+	s := httptest.NewServer(r)
+	defer s.Close()
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("POST https://example.com/account HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Absolute-form https request over HTTP: expected 403, got %d", resp.StatusCode)
+	}
+
+	// X-Forwarded-Proto is only trusted when enabled.
+	for _, trust := range []bool{false, true} {
+		r.TrustForwardedProto = trust
+		req := httptest.NewRequest("POST", "http://example.com/account", nil)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if code := map[bool]int{false: http.StatusForbidden, true: http.StatusOK}[trust]; w.Code != code {
+			t.Errorf("X-Forwarded-Proto with trust %v: expected %d, got %d", trust, code, w.Code)
+		}
+	}
+}
+
+func TestAddConcurrencyLimit(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	r := New()
+	r.AddConcurrencyLimit("GET", "/export", 1, func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil))
+		done <- w.Code
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 over the limit, got %d", w.Code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("Expected 200 within the limit, got %d", code)
+	}
+}
+
+func TestAddConcurrencyLimitInvalid(t *testing.T) {
+	for _, max := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected AddConcurrencyLimit to panic for a limit of %d", max)
+				}
+			}()
+			New().AddConcurrencyLimit("GET", "/export", max, myHandler)
+		}()
+	}
+}
+
+func TestAddProduces(t *testing.T) {
+	var mediaType string
+	r := New()
+	r.AddProduces("GET", "/report", []string{"application/json", "text/csv"}, func(w http.ResponseWriter, req *http.Request) {
+		mediaType = NegotiatedType(req)
+	})
+
+	tests := []struct {
+		accept, mediaType string
+		code              int
+	}{
+		{"", "application/json", http.StatusOK},
+		{"text/csv", "text/csv", http.StatusOK},
+		{"text/*;q=0.9, application/json;q=0.5", "text/csv", http.StatusOK},
+		{"*/*", "application/json", http.StatusOK},
+		{"image/png", "", http.StatusNotAcceptable},
+		{"application/json;q=0", "", http.StatusNotAcceptable},
+	}
+	for _, test := range tests {
+		mediaType = ""
+		req := httptest.NewRequest("GET", "/report", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code || mediaType != test.mediaType {
+			t.Errorf("Accept %q: expected %d (%q), got %d (%q)", test.accept, test.code, test.mediaType, w.Code, mediaType)
+		}
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	r := New()
+	r.Use(r.ScopeMiddleware)
+	r.RequireScopes("/admin/{section}", "admin", "write")
+	r.Get("/admin/{section}", myHandler)
+	r.Get("/public", myHandler)
+
+	tests := []struct {
+		path   string
+		scopes []string
+		code   int
+	}{
+		{"/admin/users", nil, http.StatusForbidden},
+		{"/admin/users", []string{"admin"}, http.StatusForbidden},
+		{"/admin/users", []string{"write", "admin"}, http.StatusOK},
+		{"/public", nil, http.StatusOK},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, WithScopes(httptest.NewRequest("GET", test.path, nil), test.scopes...))
+		if w.Code != test.code {
+			t.Errorf("%s with scopes %v: expected %d, got %d", test.path, test.scopes, test.code, w.Code)
+		}
+	}
+}
+
+func TestAddSharded(t *testing.T) {
+	var shard int
+	shards := make([]http.HandlerFunc, 4)
+	for i := range shards {
+		i := i
+		shards[i] = func(w http.ResponseWriter, req *http.Request) {
+			shard = i
+		}
+	}
+	r := New()
+	r.AddSharded("GET", "/users/{id}", shards, func(req *http.Request) string {
+		return req.URL.Query().Get(":id")
+	})
+
+	seen := make(map[int]bool)
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8"} {
+		shard = -1
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/"+id, nil))
+		first := shard
+		seen[first] = true
+		for i := 0; i < 3; i++ {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/"+id, nil))
+			if shard != first {
+				t.Errorf("User %s: expected shard %d, got %d", id, first, shard)
+			}
+		}
+		if expected := shardIndex(id, len(shards)); first != expected {
+			t.Errorf("User %s: expected shard %d, got %d", id, expected, first)
+		}
+	}
+	if len(seen) < 2 {
+		t.Errorf("Expected keys to be spread over shards, got %v", seen)
+	}
+}
+
+func TestAddShardedEmpty(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected AddSharded to panic without shards")
+		}
+	}()
+	New().AddSharded("GET", "/items/{id}", nil, func(req *http.Request) string { return "" })
+}
+
+func TestAddHeaderAbsent(t *testing.T) {
+	var served string
+	r := New()
+	r.AddHeaderAbsent("GET", "/feed", "Authorization", func(w http.ResponseWriter, req *http.Request) {
+		served = "anonymous"
+	})
+	r.Get("/feed", func(w http.ResponseWriter, req *http.Request) {
+		served = "authenticated"
+	})
+
+	tests := []struct {
+		auth, served string
+	}{
+		{"", "anonymous"},
+		{"Bearer token", "authenticated"},
+	}
+	for _, test := range tests {
+		served = ""
+		req := httptest.NewRequest("GET", "/feed", nil)
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if served != test.served {
+			t.Errorf("Authorization %q: expected %s handler, got %q", test.auth, test.served, served)
+		}
+	}
+}
+
+func TestAddMinTLS(t *testing.T) {
+	r := New()
+	r.AddMinTLS("GET", "/payments", tls.VersionTLS12, myHandler)
+
+	tests := []struct {
+		state *tls.ConnectionState
+		code  int
+	}{
+		{nil, http.StatusForbidden},
+		{&tls.ConnectionState{Version: tls.VersionTLS11}, http.StatusForbidden},
+		{&tls.ConnectionState{Version: tls.VersionTLS13}, http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/payments", nil)
+		req.TLS = test.state
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("TLS %v: expected %d, got %d", test.state, test.code, w.Code)
+		}
+	}
+}
+
+func TestAddDefaultQuery(t *testing.T) {
+	var q url.Values
+	r := New()
+	r.AddDefaultQuery("GET", "/users/{id}/posts", url.Values{"limit": {"20"}, "sort": {"new"}}, func(w http.ResponseWriter, req *http.Request) {
+		q = req.URL.Query()
+	})
+
+	tests := []struct {
+		url, limit, sort string
+	}{
+		{"/users/1/posts", "20", "new"},
+		{"/users/1/posts?limit=5", "5", "new"},
+		{"/users/1/posts?limit=5&sort=old", "5", "old"},
+	}
+	for _, test := range tests {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.url, nil))
+		if q.Get("limit") != test.limit || q.Get("sort") != test.sort || q.Get(":id") != "1" {
+			t.Errorf("%s: expected limit=%s, sort=%s and :id=1, got %v", test.url, test.limit, test.sort, q)
+		}
+		if len(q["limit"]) != 1 {
+			t.Errorf("%s: expected a single limit, got %v", test.url, q["limit"])
+		}
+	}
+}
+
+// memoryStore is an in-memory IdempotencyStore.
+type memoryStore struct {
+	mu        sync.Mutex
+	responses map[string]*CachedResponse
+}
+
+func (s *memoryStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.responses[key]
+	return resp, ok
+}
+
+func (s *memoryStore) Set(key string, resp *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[key] = resp
+}
+
+func TestRequireIdempotencyKey(t *testing.T) {
+	var calls int
+	r := New()
+	r.RequireIdempotencyKey("POST", "/payments", &memoryStore{responses: make(map[string]*CachedResponse)}, func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.Header().Set("X-Payment", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	tests := []struct {
+		key   string
+		code  int
+		calls int
+	}{
+		{"", http.StatusBadRequest, 0},
+		{"abc", http.StatusCreated, 1},
+		{"abc", http.StatusCreated, 1},
+		{"def", http.StatusCreated, 2},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("POST", "/payments", nil)
+		if test.key != "" {
+			req.Header.Set("Idempotency-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code || calls != test.calls {
+			t.Errorf("Request %d (key %q): expected %d after %d calls, got %d after %d calls", i, test.key, test.code, test.calls, w.Code, calls)
+		}
+		if test.code == http.StatusCreated && (w.Body.String() != "created" || w.Header().Get("X-Payment") != "1") {
+			t.Errorf("Request %d (key %q): expected full response, got %q", i, test.key, w.Body.String())
+		}
+	}
+}
+
+func TestRequireIdempotencyKeySharedStore(t *testing.T) {
+	store := &memoryStore{responses: make(map[string]*CachedResponse)}
+	r := New()
+	for _, name := range []string{"payments", "refunds"} {
+		name := name
+		r.RequireIdempotencyKey("POST", "/"+name, store, func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+
+	for _, name := range []string{"payments", "refunds", "payments"} {
+		req := httptest.NewRequest("POST", "/"+name, nil)
+		req.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Body.String() != name {
+			t.Errorf("/%s with a key used on another route: expected %q, got %q", name, name, w.Body.String())
+		}
+	}
+	if _, ok := store.Get("POST /refunds k1"); !ok {
+		t.Errorf("Expected key %q in store", "POST /refunds k1")
+	}
+}
+
+func TestRequireBearer(t *testing.T) {
+	var token string
+	r := New()
+	r.RequireBearer("GET", "/me", func(w http.ResponseWriter, req *http.Request) {
+		token = BearerToken(req)
+	})
+
+	tests := []struct {
+		auth, token string
+		code        int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"Basic dXNlcjpwYXNz", "", http.StatusUnauthorized},
+		{"Bearer", "", http.StatusUnauthorized},
+		{"Bearer two tokens", "", http.StatusUnauthorized},
+		{"Bearer mF_9.B5f-4.1JqM", "mF_9.B5f-4.1JqM", http.StatusOK},
+		{"bearer abc==", "abc==", http.StatusOK},
+	}
+	for _, test := range tests {
+		token = ""
+		req := httptest.NewRequest("GET", "/me", nil)
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code || token != test.token {
+			t.Errorf("Authorization %q: expected %d (%q), got %d (%q)", test.auth, test.code, test.token, w.Code, token)
+		}
+		if w.Code == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Errorf("Authorization %q: expected Bearer challenge, got %q", test.auth, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	var served string
+	r := New()
+	r.WebSocket("/live", func(w http.ResponseWriter, req *http.Request) {
+		served = "websocket"
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+	})
+	r.Get("/live", func(w http.ResponseWriter, req *http.Request) {
+		served = "plain"
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/live", nil))
+	if served != "plain" {
+		t.Errorf("Expected plain GET handler, got %q", served)
+	}
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /live HTTP/1.1\r\nHost: example.com\r\nConnection: keep-alive, Upgrade\r\nUpgrade: WebSocket\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || served != "websocket" {
+		t.Errorf("Expected hijacked upgrade, got %d (%q)", resp.StatusCode, served)
+	}
+}
+
+func TestDeprecate(t *testing.T) {
+	sunset := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	r := New()
+	r.Use(r.DeprecationMiddleware)
+	r.Deprecate("/v1/users", sunset, "/v2/users")
+	r.Get("/v1/users", myHandler)
+	r.Get("/v2/users", myHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/users", nil))
+	if got := w.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation: expected %q, got %q", "true", got)
+	}
+	if got, want := w.Header().Get("Sunset"), "Fri, 01 Jan 2027 00:00:00 GMT"; got != want {
+		t.Errorf("Sunset: expected %q, got %q", want, got)
+	}
+	if got, want := w.Header().Get("Link"), `</v2/users>; rel="successor-version"`; got != want {
+		t.Errorf("Link: expected %q, got %q", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v2/users", nil))
+	for _, name := range []string{"Deprecation", "Sunset", "Link"} {
+		if got := w.Header().Get(name); got != "" {
+			t.Errorf("%s on /v2/users: expected none, got %q", name, got)
+		}
+	}
+}
+
+func TestAddDepth(t *testing.T) {
+	r := New()
+	r.AddDepth("GET", 2, myHandler)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/a/b", http.StatusOK},
+		{"/x/y/", http.StatusOK},
+		{"/a", http.StatusNotFound},
+		{"/a/b/c", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.path, test.code, w.Code)
+		}
+	}
+}
+
+func TestRequireScopesBothSlash(t *testing.T) {
+	r := New()
+	r.Use(r.ScopeMiddleware)
+	r.RequireScopes("/admin", "admin")
+	r.AddBothSlash("GET", "/admin", myHandler)
+
+	for _, path := range []string{"/admin", "/admin/"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s without scopes: expected 403, got %d", path, w.Code)
+		}
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, WithScopes(httptest.NewRequest("GET", path, nil), "admin"))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s with scopes: expected 200, got %d", path, w.Code)
+		}
+	}
+}
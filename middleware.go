@@ -0,0 +1,177 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConditionalMiddleware returns a middleware that applies mw only to requests
+// whose matched route pattern satisfies pred. It must be installed with Use,
+// so that it runs after matching:
+//
+//	r.Use(pat.ConditionalMiddleware(func(route string) bool {
+//		return strings.HasPrefix(route, "/admin/")
+//	}, AuthMiddleware))
+func ConditionalMiddleware(pred func(route string) bool, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		wrapped := mw(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if pred(currentPattern(req)) {
+				wrapped.ServeHTTP(w, req)
+				return
+			}
+			h.ServeHTTP(w, req)
+		})
+	}
+}
+
+// Deadline returns a middleware that gives requests a context deadline of d.
+// If the handler has not returned by then, its context is canceled and, if it
+// has not written anything yet, a 504 Gateway Timeout is sent in its place;
+// later writes fail with http.ErrHandlerTimeout. Unlike http.TimeoutHandler,
+// the response is not buffered, and the middleware still waits for the
+// handler to return, so handlers should stop when their context is done.
+func Deadline(d time.Duration) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			deadline := time.Now().Add(d)
+			ctx, cancel := context.WithDeadline(req.Context(), deadline)
+			defer cancel()
+			dw := &deadlineWriter{w: w, header: make(http.Header), deadline: deadline}
+			timer := time.AfterFunc(d, func() {
+				dw.mu.Lock()
+				if !dw.done {
+					dw.expire()
+				}
+				dw.mu.Unlock()
+			})
+			defer timer.Stop()
+			h.ServeHTTP(dw, req.WithContext(ctx))
+			dw.mu.Lock()
+			dw.checkDeadline()
+			dw.done = true
+			dw.mu.Unlock()
+		})
+	}
+}
+
+// deadlineWriter is the response writer given to handlers by Deadline. Its
+// mutex serializes the handler's writes with the 504 sent on timeout, either
+// by the watchdog timer or by the first write or return past the deadline,
+// whichever comes first.
+type deadlineWriter struct {
+	w        http.ResponseWriter
+	header   http.Header
+	deadline time.Time
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+	done        bool
+}
+
+// Header returns the header map of the handler's response, which is copied
+// to the underlying writer when the header is written.
+func (dw *deadlineWriter) Header() http.Header {
+	return dw.header
+}
+
+// WriteHeader sends the response header, unless the request timed out.
+func (dw *deadlineWriter) WriteHeader(code int) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.checkDeadline()
+	dw.writeHeader(code)
+}
+
+// Write writes the data to the response, unless the request timed out.
+func (dw *deadlineWriter) Write(b []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.checkDeadline() {
+		return 0, http.ErrHandlerTimeout
+	}
+	dw.writeHeader(http.StatusOK)
+	return dw.w.Write(b)
+}
+
+// Flush sends the header, if needed, and any buffered data to the client,
+// unless the request timed out.
+func (dw *deadlineWriter) Flush() {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.checkDeadline() {
+		return
+	}
+	dw.writeHeader(http.StatusOK)
+	if f, ok := dw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, if supported and the
+// request did not time out. No 504 is sent after that.
+func (dw *deadlineWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.checkDeadline() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	h, ok := dw.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("pat: response does not implement http.Hijacker")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		dw.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (dw *deadlineWriter) Unwrap() http.ResponseWriter {
+	return dw.w
+}
+
+// writeHeader copies the header and sends it once. The mutex must be held.
+func (dw *deadlineWriter) writeHeader(code int) {
+	if dw.timedOut || dw.wroteHeader {
+		return
+	}
+	dw.wroteHeader = true
+	dst := dw.w.Header()
+	for k, v := range dw.header {
+		dst[k] = v
+	}
+	dw.w.WriteHeader(code)
+}
+
+// checkDeadline expires the request if its deadline has passed, and reports
+// whether it timed out. The mutex must be held.
+func (dw *deadlineWriter) checkDeadline() bool {
+	if !dw.timedOut && !time.Now().Before(dw.deadline) {
+		dw.expire()
+	}
+	return dw.timedOut
+}
+
+// expire sends a 504 Gateway Timeout if nothing was written yet, and makes
+// later writes fail. The mutex must be held.
+func (dw *deadlineWriter) expire() {
+	if dw.timedOut {
+		return
+	}
+	dw.timedOut = true
+	if !dw.wroteHeader {
+		http.Error(dw.w, "gateway timeout", http.StatusGatewayTimeout)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConditionalMiddleware(t *testing.T) {
+	auth := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, req)
+		})
+	}
+	r := New()
+	r.Use(ConditionalMiddleware(func(route string) bool {
+		return strings.HasPrefix(route, "/admin/")
+	}, auth))
+	r.Get("/admin/{section}", myHandler)
+	r.Get("/public", myHandler)
+
+	tests := []struct {
+		path, auth string
+		code       int
+	}{
+		{"/admin/users", "", http.StatusUnauthorized},
+		{"/admin/users", "secret", http.StatusOK},
+		{"/public", "", http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s (auth %q): expected %d, got %d", test.path, test.auth, test.code, w.Code)
+		}
+	}
+}
+
+func TestSetMiddleware(t *testing.T) {
+	stack := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Add("X-Stack", name)
+				h.ServeHTTP(w, req)
+			})
+		}
+	}
+	r := New()
+	r.Get("/", myHandler)
+	r.SetMiddleware(stack("a1"), stack("a2"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(w.Header()["X-Stack"], ","); got != "a1,a2" {
+		t.Errorf("Expected stack a1,a2, got %q", got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if got := strings.Join(w.Header()["X-Stack"], ","); got != "a1,a2" && got != "b" {
+				t.Errorf("Expected a complete stack, got %q", got)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				r.SetMiddleware(stack("b"))
+			} else {
+				r.SetMiddleware(stack("a1"), stack("a2"))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDeadline(t *testing.T) {
+	var writeErr error
+	r := New()
+	r.Use(Deadline(20 * time.Millisecond))
+	r.Get("/slow", func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		w.Header().Set("X-Late", "true")
+		_, writeErr = w.Write([]byte("too late"))
+	})
+	r.Get("/fast", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Fast", "true")
+		w.Write([]byte("ok"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Slow handler: expected 504, got %d", w.Code)
+	}
+	if writeErr != http.ErrHandlerTimeout {
+		t.Errorf("Late write: expected %v, got %v", http.ErrHandlerTimeout, writeErr)
+	}
+	if strings.Contains(w.Body.String(), "too late") || w.Header().Get("X-Late") != "" {
+		t.Errorf("Late write: expected it dropped, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" || w.Header().Get("X-Fast") != "true" {
+		t.Errorf("Fast handler: expected 200 %q with X-Fast, got %d %q", "ok", w.Code, w.Body.String())
+	}
+}
+
+func TestDeadlineStreaming(t *testing.T) {
+	r := New()
+	r.Use(Deadline(time.Second))
+	r.Get("/stream", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+	})
+	r.WebSocket("/live", func(w http.ResponseWriter, req *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/stream", nil))
+	if !w.Flushed || w.Body.String() != "data: 1\n\n" || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected flushed event stream, got flushed %v, %q", w.Flushed, w.Body.String())
+	}
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /live HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected hijacked upgrade under Deadline, got %d", resp.StatusCode)
+	}
+}
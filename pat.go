@@ -5,19 +5,24 @@
 package pat
 
 import (
+	"net"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
+	"golang.org/x/text/unicode/norm"
 )
 
 // 工厂方法
 // New returns a new router.
 func New() *Router {
-	return &Router{}
+	return &Router{Router: *mux.NewRouter()}
 }
 
 // Router is a request router that implements a pat-like API.
@@ -25,12 +30,220 @@ func New() *Router {
 // pat docs: http://godoc.org/github.com/bmizerany/pat
 type Router struct {
 	mux.Router
+	// AllowEmptySegmentVars makes empty path segments (as in "/users//posts")
+	// match route variables, which are then captured as empty strings.
+	// Otherwise such requests are rejected with 400 Bad Request. Empty
+	// segments that do not fall on a variable are redirected to the cleaned
+	// path as usual.
+	AllowEmptySegmentVars bool
+	// DefaultContentType is set as the Content-Type of responses whose
+	// handler did not set one. If empty, the content type is sniffed by
+	// net/http as usual.
+	DefaultContentType string
+	// NormalizeUnicode applies Unicode normalization form C to request paths
+	// before matching, so that composed and decomposed forms of the same
+	// characters match the same routes.
+	NormalizeUnicode bool
+	// AutoOptions answers OPTIONS requests for paths without an OPTIONS
+	// route, listing the methods registered for the requested path in the
+	// Allow header and, for CORS preflight requests, in the
+	// Access-Control-Allow-Methods header.
+	AutoOptions bool
+	// AutoHead serves HEAD requests for paths without a HEAD route with the
+	// GET route of the path, if any.
+	AutoHead bool
+	// MethodNotAllowed answers requests whose path only matches routes for
+	// other methods with a 405 Method Not Allowed listing them in the Allow
+	// header. Otherwise such requests get a 404 Not Found, as if no route
+	// matched. With prefix routes, a route for "/" makes every path match.
+	MethodNotAllowed bool
+	// TimeoutMessage is the body of the 503 response sent by routes
+	// registered with AddResponseTimeout when they time out. It is read when
+	// the response is sent, so it may be set after the routes are
+	// registered. If empty, the default message of http.TimeoutHandler is
+	// used.
+	TimeoutMessage string
+	// LowercaseHost, StripHostPort and StripHostDot canonicalize the request
+	// host before matching, so that "EXAMPLE.com.:443" matches routes for
+	// "example.com". StripHostDot removes the trailing dot of fully
+	// qualified domain names.
+	LowercaseHost bool
+	StripHostPort bool
+	StripHostDot  bool
+	// Aliases maps old paths to new ones. Requests to an old path that no
+	// route matches are served as if made to the new path or, if
+	// RedirectAliases is set, redirected to it.
+	Aliases         map[string]string
+	RedirectAliases bool
+	// SkipCleanMethods lists the request methods, such as WebDAV's PROPFIND,
+	// whose paths are matched as is instead of being cleaned and redirected.
+	SkipCleanMethods []string
+	// CollectStats records the latency of the requests served by each route,
+	// to be queried with RouteStats.
+	CollectStats bool
+	// RejectSmuggling rejects requests carrying both a chunked
+	// Transfer-Encoding and a Content-Length with a 400 Bad Request, before
+	// matching, as a defense against request smuggling. net/http's server
+	// already drops the Content-Length of such requests, so this matters when
+	// the router is reached otherwise, e.g. called directly or through an
+	// adapter for another server.
+	RejectSmuggling bool
+	// BufferBodyLimit, if positive, makes the router buffer request bodies
+	// with BufferBody before matching, so that they can be read more than
+	// once. Bodies larger than the limit, in bytes, are rejected with a 413
+	// Request Entity Too Large.
+	BufferBodyLimit int64
+	// PreserveVarSlashes matches requests on their path with encoded slashes
+	// ("%2F") left encoded, so that they are cleaned and split into segments
+	// as part of variable values instead of as separators: with it,
+	// "/search/a%2Fb" matches "/search/{q}" with q set to "a/b". Variable
+	// values are unescaped after matching.
+	PreserveVarSlashes bool
+	// MaxSegments, if positive, is the maximum number of segments of the
+	// cleaned request path. Longer paths are rejected with a 414 Request URI
+	// Too Long before matching.
+	MaxSegments int
+	// OnError, if set, is called after every response with a status code of
+	// 400 or above, with the pattern of the matched route ("" if none).
+	OnError func(route string, status int, req *http.Request)
+	// ClientIP, if set, determines the client IP address returned by the
+	// ClientIP function for the requests served by the router. By default,
+	// the host part of RemoteAddr is used or, if TrustForwardedFor is set,
+	// the first address of the X-Forwarded-For header, when present. Only
+	// set TrustForwardedFor behind a proxy that overwrites that header.
+	ClientIP          func(*http.Request) string
+	TrustForwardedFor bool
+	// TrustForwardedProto makes routes registered with AddSecure accept
+	// requests whose X-Forwarded-Proto header is "https" as secure. Only set
+	// it behind a TLS-terminating proxy that overwrites that header.
+	TrustForwardedProto bool
+	// meta holds pat-specific settings of registered routes.
+	meta map[*mux.Route]*routeMeta
+	// exact holds the routes registered with Exact.
+	exact []*mux.Route
+	// scopes holds the scopes required by RequireScopes, by pattern.
+	scopes map[string][]string
+	// noCompress holds the patterns exempted by NoCompress.
+	noCompress map[string]bool
+	// deprecations holds the routes marked by Deprecate, by pattern.
+	deprecations map[string]deprecation
+	// stats holds the latency samples collected by CollectStats, by pattern.
+	statsMu sync.Mutex
+	stats   map[string]*reservoir
+	// middleware holds the stack set by SetMiddleware, as a
+	// []func(http.Handler) http.Handler.
+	middleware atomic.Value
+	// maintenance holds the allowed patterns while in maintenance mode, as
+	// a map[string]bool, or nil.
+	maintenance atomic.Value
+	// maxInFlight and inFlight are the limit set by MaxInFlight and the
+	// number of requests being served, accessed atomically.
+	maxInFlight, inFlight int32
+	// accessLog holds the writer set by AccessLog, as a logWriter, and
+	// accessLogMu serializes the lines written to it.
+	accessLog   atomic.Value
+	accessLogMu sync.Mutex
+}
+
+// routeMeta holds pat-specific settings of a route.
+type routeMeta struct {
+	transforms map[string]func(string) string
+	// varNames holds the names of the pattern variables, in order.
+	varNames []string
+	// pattern is the pattern the route was registered for, if it differs
+	// from its path template, as for the variants added by AddBothSlash.
+	pattern string
+}
+
+// routeMeta returns the settings of the given route, creating them if needed.
+func (r *Router) routeMeta(route *mux.Route) *routeMeta {
+	if r.meta == nil {
+		r.meta = make(map[*mux.Route]*routeMeta)
+	}
+	m, ok := r.meta[route]
+	if !ok {
+		m = &routeMeta{}
+		r.meta[route] = m
+	}
+	return m
 }
 
 // 注册方法到匹配的路径
 // Add registers a pattern with a handler for the given request method.
+//
+// The pattern matches path prefixes, but yields to routes registered with
+// Exact when they match the whole path, regardless of registration order.
 func (r *Router) Add(meth, pat string, h http.Handler) *mux.Route {
-	return r.NewRoute().PathPrefix(pat).Handler(h).Methods(meth)
+	route := r.NewRoute().PathPrefix(pat).MatcherFunc(r.notExact).Handler(h).Methods(meth)
+	r.routeMeta(route).varNames = varNames(pat)
+	return route
+}
+
+// AddMany registers several patterns with the same handler for the given
+// request method, e.g. "/" and "/index.html". It returns the created routes
+// in the same order as the patterns.
+func (r *Router) AddMany(meth string, patterns []string, h http.HandlerFunc) []*mux.Route {
+	routes := make([]*mux.Route, len(patterns))
+	for i, pat := range patterns {
+		routes[i] = r.Add(meth, pat, h)
+	}
+	return routes
+}
+
+// Exact registers a pattern with a handler for the given request method,
+// matching only the whole path. Exact routes take precedence over the prefix
+// routes registered with Add or the method shortcuts, so that "/files" can
+// be served apart from "/files/{name}" by a prefix route for "/files".
+func (r *Router) Exact(meth, pat string, h http.HandlerFunc) *mux.Route {
+	route := r.NewRoute().Path(pat).Handler(h).Methods(meth)
+	r.routeMeta(route).varNames = varNames(pat)
+	r.exact = append(r.exact, route)
+	return route
+}
+
+// AddBothSlash registers a pattern with a handler for the given request
+// method, matching exactly both the pattern with and without a trailing
+// slash, e.g. "/users" and "/users/", without redirecting one to the other.
+// It returns the routes without and with the slash, in that order.
+//
+// Both routes share the given pattern for the settings keyed by pattern, such
+// as RequireScopes, NoCompress, Deprecate and MaintenanceMode.
+func (r *Router) AddBothSlash(meth, pat string, h http.HandlerFunc) []*mux.Route {
+	base := strings.TrimRight(pat, "/")
+	if base == "" {
+		return []*mux.Route{r.Exact(meth, "/", h)}
+	}
+	routes := []*mux.Route{r.Exact(meth, base, h), r.Exact(meth, base+"/", h)}
+	for _, route := range routes {
+		if routePattern(route) != pat {
+			r.routeMeta(route).pattern = pat
+		}
+	}
+	return routes
+}
+
+// notExact is a matcher for prefix routes that fails when an exact route
+// matches the request.
+func (r *Router) notExact(req *http.Request, match *mux.RouteMatch) bool {
+	for _, route := range r.exact {
+		if route.Match(req, &mux.RouteMatch{}) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddTransform registers a pattern with a handler for the given request
+// method, transforming the captured variables before they are stored in the
+// URL query. The transforms are keyed by variable name, e.g.:
+//
+//	r.AddTransform("GET", "/articles/{slug}", map[string]func(string) string{
+//		"slug": strings.ToLower,
+//	}, ArticleHandler)
+func (r *Router) AddTransform(meth, pat string, transforms map[string]func(string) string, h http.HandlerFunc) *mux.Route {
+	route := r.Add(meth, pat, h)
+	r.routeMeta(route).transforms = transforms
+	return route
 }
 
 // 注册Options请求处理的方法
@@ -76,40 +289,467 @@ func (r *Router) Patch(pat string, h http.HandlerFunc) *mux.Route {
 	return r.Add("PATCH", pat, h)
 }
 
+// MaxInFlight caps the number of requests served concurrently by the router
+// to n. Requests over the limit are shed with a 503 Service Unavailable and a
+// Retry-After header. A limit of 0 removes the cap.
+func (r *Router) MaxInFlight(n int) {
+	atomic.StoreInt32(&r.maxInFlight, int32(n))
+}
+
+// SetMiddleware atomically replaces the router-wide middleware stack, e.g. on
+// a configuration reload, while requests are being served; requests in flight
+// keep the stack they started with. Unlike the middleware added with Use,
+// which only wraps matched routes, this stack wraps every handler dispatched
+// by the router, including the NotFoundHandler. The first middleware is the
+// outermost.
+func (r *Router) SetMiddleware(mw ...func(http.Handler) http.Handler) {
+	r.middleware.Store(append([]func(http.Handler) http.Handler(nil), mw...))
+}
+
+// MaintenanceMode turns maintenance mode on or off. While on, every request
+// gets a 503 Service Unavailable with a Retry-After header, except those whose
+// matched route pattern is in allow, such as health checks.
+func (r *Router) MaintenanceMode(on bool, allow []string) {
+	var patterns map[string]bool
+	if on {
+		patterns = make(map[string]bool, len(allow))
+		for _, pat := range allow {
+			patterns[pat] = true
+		}
+	}
+	r.maintenance.Store(patterns)
+}
+
+// maintenanceHandler responds to requests in maintenance mode.
+func maintenanceHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Retry-After", "120")
+	http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+}
+
 // 分发
 
 // ServeHTTP dispatches the handler registered in the matched route.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// 路径处理
-	// Clean path to canonical form and redirect.
-	if p := cleanPath(req.URL.Path); p != req.URL.Path {
-		w.Header().Set("Location", p)
-		w.WriteHeader(http.StatusMovedPermanently)
-		return
+	rw := &responseWriter{ResponseWriter: w, contentType: r.DefaultContentType}
+	start := time.Now()
+	req, route := r.serve(rw, req)
+	r.finish(rw, req, route, start)
+}
+
+// serve responds to the request, either directly or with the handler of the
+// matched route. It returns the request as given to the handler, if any, and
+// the matched route.
+func (r *Router) serve(w *responseWriter, req *http.Request) (*http.Request, *mux.Route) {
+	if max := atomic.LoadInt32(&r.maxInFlight); max > 0 {
+		if atomic.AddInt32(&r.inFlight, 1) > max {
+			atomic.AddInt32(&r.inFlight, -1)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server overloaded", http.StatusServiceUnavailable)
+			return req, nil
+		}
+		defer atomic.AddInt32(&r.inFlight, -1)
+	}
+	if !r.KeepContext {
+		defer context.Clear(req)
+	}
+	if r.RejectSmuggling && isSmuggling(req) {
+		http.Error(w, "conflicting Transfer-Encoding and Content-Length", http.StatusBadRequest)
+		return req, nil
+	}
+	if r.BufferBodyLimit > 0 && req.Body != nil {
+		// MaxBytesReader reads past the limit only if the body exceeds it.
+		body := &countingBody{ReadCloser: req.Body}
+		req.Body = http.MaxBytesReader(w.ResponseWriter, body, r.BufferBodyLimit)
+		if _, err := BufferBody(req); err != nil {
+			if body.n > r.BufferBodyLimit {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			} else {
+				http.Error(w, "error reading request body", http.StatusBadRequest)
+			}
+			return req, nil
+		}
+	}
+	// Match on a copy of the request, whose path is restored before
+	// dispatching if it was changed for matching only.
+	req, origPath, origRawPath := r.prepare(req)
+	matchPath := req.URL.Path
+	if r.MaxSegments > 0 && pathDepth(cleanPath(req.URL.Path)) > r.MaxSegments {
+		http.Error(w, "too many path segments", http.StatusRequestURITooLong)
+		return req, nil
+	}
+	req, handler, route, target := r.resolve(req)
+	if target != "" {
+		redirect(w, target)
+		return req, nil
 	}
+	if req.URL.Path == matchPath {
+		req.URL.Path, req.URL.RawPath = origPath, origRawPath
+	}
+	return r.dispatch(w, req, handler, route), route
+}
+
+// resolve decides how to serve req, as prepared for matching. It returns the
+// request to give the handler, the handler, or nil if the router has none for
+// the request, and the matched route. If the request is to be redirected
+// instead, it returns the target path.
+func (r *Router) resolve(req *http.Request) (*http.Request, http.Handler, *mux.Route, string) {
 	var match mux.RouteMatch
 	var handler http.Handler
-	if matched := r.Match(req, &match); matched {
+	// Clean path to canonical form and redirect.
+	if p := cleanPath(req.URL.Path); p != req.URL.Path && !r.skipClean(req.Method) {
+		if !r.matchEmptySegments(req, &match) {
+			return req, nil, nil, p
+		}
+		if r.AllowEmptySegmentVars {
+			handler = match.Handler
+			req = r.setVars(req, &match)
+		} else {
+			handler, match.Route = http.HandlerFunc(emptySegmentHandler), nil
+		}
+	} else if r.Match(req, &match) && match.MatchErr != mux.ErrNotFound {
 		handler = match.Handler
-		registerVars(req, match.Vars)
+		req = r.setVars(req, &match)
+	}
+	if r.AutoHead && req.Method == "HEAD" && match.MatchErr == mux.ErrMethodMismatch {
+		get := *req
+		get.Method = "GET"
+		var m mux.RouteMatch
+		if r.Match(&get, &m) && m.MatchErr == nil {
+			match, handler = m, m.Handler
+			req = r.setVars(req, &match)
+		}
 	}
-	
+	if target, ok := r.Aliases[req.URL.Path]; ok && match.MatchErr == mux.ErrNotFound {
+		if r.RedirectAliases {
+			return req, nil, nil, target
+		}
+		req.URL.Path, req.URL.RawPath = target, ""
+		match = mux.RouteMatch{}
+		if r.Match(req, &match) && match.MatchErr != mux.ErrNotFound {
+			handler = match.Handler
+			req = r.setVars(req, &match)
+		}
+	}
+	if r.AutoOptions && req.Method == "OPTIONS" && (handler == nil || match.MatchErr != nil) {
+		if methods := r.allowedMethods(req); len(methods) > 0 {
+			handler = optionsHandler(methods)
+		}
+	}
+	if r.MethodNotAllowed && handler == nil && match.MatchErr == mux.ErrMethodMismatch {
+		methods := r.allowedMethods(req)
+		if r.AutoOptions {
+			methods = append(methods, "OPTIONS")
+		}
+		handler = methodNotAllowedHandler(methods)
+	}
+	return req, handler, match.Route, ""
+}
+
+// prepare returns a shallow copy of req, with its own URL, whose host and path
+// are canonicalized for matching according to the router settings. With
+// PreserveVarSlashes, the path of the copy keeps encoded slashes; the path and
+// raw path to give handlers instead are returned as well.
+func (r *Router) prepare(req *http.Request) (*http.Request, string, string) {
+	u := *req.URL
+	preq := *req
+	preq.URL = &u
+	if r.LowercaseHost || r.StripHostPort || r.StripHostDot {
+		preq.Host = r.canonicalHost(preq.Host)
+		if u.Host != "" {
+			u.Host = r.canonicalHost(u.Host)
+		}
+	}
+	// 路径处理
+	escaped := u.EscapedPath()
+	if r.NormalizeUnicode {
+		if p := norm.NFC.String(u.Path); p != u.Path {
+			u.Path, u.RawPath = p, ""
+		}
+	}
+	path, rawPath := u.Path, u.RawPath
+	if r.PreserveVarSlashes {
+		p := slashPreservingPath(escaped)
+		if r.NormalizeUnicode {
+			p = norm.NFC.String(p)
+		}
+		u.Path, u.RawPath = p, ""
+	}
+	return &preq, path, rawPath
+}
+
+// handles reports whether the router would serve the request with a handler
+// of its own or an alias redirect, rather than its NotFoundHandler. A redirect
+// to the clean path only counts if the router serves that path.
+func (r *Router) handles(req *http.Request) bool {
+	req, _, _ = r.prepare(req)
+	req, handler, _, target := r.resolve(req)
+	if target != "" && target != req.URL.Path && target == cleanPath(req.URL.Path) {
+		req.URL.Path, req.URL.RawPath = target, ""
+		_, handler, _, target = r.resolve(req)
+	}
+	return handler != nil || target != ""
+}
+
+// isSmuggling reports whether req has both a chunked Transfer-Encoding and a
+// Content-Length.
+func isSmuggling(req *http.Request) bool {
+	if _, ok := req.Header["Content-Length"]; !ok {
+		return false
+	}
+	te := append(append([]string(nil), req.TransferEncoding...), req.Header["Transfer-Encoding"]...)
+	for _, v := range te {
+		if strings.Contains(strings.ToLower(v), "chunked") {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalHost returns host canonicalized according to the router settings.
+func (r *Router) canonicalHost(host string) string {
+	h, port, err := net.SplitHostPort(host)
+	if err != nil {
+		h, port = host, ""
+	}
+	if r.StripHostDot {
+		h = strings.TrimSuffix(h, ".")
+	}
+	if r.LowercaseHost {
+		h = strings.ToLower(h)
+	}
+	if err != nil {
+		return h
+	}
+	if r.StripHostPort {
+		if strings.Contains(h, ":") {
+			h = "[" + h + "]"
+		}
+		return h
+	}
+	return net.JoinHostPort(h, port)
+}
+
+// skipClean reports whether paths of requests with the given method are
+// matched without cleaning.
+func (r *Router) skipClean(meth string) bool {
+	for _, m := range r.SkipCleanMethods {
+		if m == meth {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch serves the request with h, or with the NotFoundHandler if h is nil.
+// The matched route, if any, is used for reporting. It returns the request as
+// given to the handler.
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request, h http.Handler, route *mux.Route) *http.Request {
 	// 没有匹配的请求处理函数
-	if handler == nil {
-		if r.NotFoundHandler == nil {
-			r.NotFoundHandler = http.NotFoundHandler()
+	if h == nil {
+		if h = r.NotFoundHandler; h == nil {
+			h = http.NotFoundHandler()
+		}
+	}
+	if allow, _ := r.maintenance.Load().(map[string]bool); allow != nil && !allow[r.pattern(route)] {
+		h = http.HandlerFunc(maintenanceHandler)
+	}
+	if mw, _ := r.middleware.Load().([]func(http.Handler) http.Handler); len(mw) > 0 {
+		for i := len(mw) - 1; i >= 0; i-- {
+			h = mw[i](h)
 		}
-		handler = r.NotFoundHandler
 	}
+	if route != nil {
+		req = withRoute(req, route, r.pattern(route))
+	}
+	req = withClientIP(req, r.clientIP(req))
+	// The handler gets a copy of the request, which must be cleared as well.
 	if !r.KeepContext {
 		defer context.Clear(req)
 	}
 	// 处理请求
-	handler.ServeHTTP(w, req)
+	start := time.Now()
+	h.ServeHTTP(w, req)
+	if r.CollectStats && route != nil {
+		r.observe(r.pattern(route), time.Since(start))
+	}
+	return req
+}
+
+// finish reports a response written through rw, from start on, to OnError
+// and the access log. Every request served by the router is reported,
+// including those answered before matching.
+func (r *Router) finish(rw *responseWriter, req *http.Request, route *mux.Route, start time.Time) {
+	if r.OnError != nil && rw.status >= 400 {
+		r.OnError(r.pattern(route), rw.status, req)
+	}
+	r.logAccess(req, rw, start)
+}
+
+// clientIP returns the client IP address of the request.
+func (r *Router) clientIP(req *http.Request) string {
+	if r.ClientIP != nil {
+		return r.ClientIP(req)
+	}
+	if r.TrustForwardedFor {
+		if ip := forwardedIP(req); ip != "" {
+			return ip
+		}
+	}
+	return remoteIP(req)
+}
+
+// Combine returns a handler that serves each request with the first of the
+// given routers that has a matching route, so that independent modules can
+// contribute their own routers. If none does, the last router serves it,
+// e.g. with its NotFoundHandler. Requests are served by the chosen router's
+// ServeHTTP, so that all of its settings apply.
+func Combine(routers ...*Router) http.Handler {
+	return combined(routers)
+}
+
+// combined is the handler returned by Combine.
+type combined []*Router
+
+// ServeHTTP dispatches the handler registered in the first matched route.
+func (c combined) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if len(c) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+	for _, r := range c[:len(c)-1] {
+		if r.handles(req) {
+			r.ServeHTTP(w, req)
+			return
+		}
+	}
+	c[len(c)-1].ServeHTTP(w, req)
+}
+
+// pattern returns the pattern route was registered for, or "" if route is
+// nil. Settings keyed by pattern are looked up with it.
+func (r *Router) pattern(route *mux.Route) string {
+	if m, ok := r.meta[route]; ok && m.pattern != "" {
+		return m.pattern
+	}
+	return routePattern(route)
+}
+
+// routePattern returns the path template of route, or "" if it has none.
+func routePattern(route *mux.Route) string {
+	if route == nil {
+		return ""
+	}
+	pattern, _ := route.GetPathTemplate()
+	return pattern
+}
+
+// redirect responds with a permanent redirect to the canonical path p.
+func redirect(w http.ResponseWriter, p string) {
+	w.Header().Set("Location", p)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// emptySegment stands in for an empty path segment while matching, so that
+// it can be captured by a variable and told apart from any real value.
+const emptySegment = "\x00"
+
+// matchEmptySegments matches a path containing empty segments, such as
+// "/users//posts". It reports whether a route matched with every empty
+// segment captured by a variable; those variables are set to "".
+func (r *Router) matchEmptySegments(req *http.Request, match *mux.RouteMatch) bool {
+	parts, empty := strings.Split(req.URL.Path, "/"), 0
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] == "" {
+			parts[i] = emptySegment
+			empty++
+		}
+	}
+	p := strings.Join(parts, "/")
+	if empty == 0 || cleanPath(p) != p {
+		return false
+	}
+	u := *req.URL
+	u.Path, u.RawPath = p, ""
+	mreq := *req
+	mreq.URL = &u
+	if !r.Match(&mreq, match) || match.MatchErr != nil {
+		return false
+	}
+	for k, v := range match.Vars {
+		if n := strings.Count(v, emptySegment); n > 0 {
+			match.Vars[k] = strings.Replace(v, emptySegment, "", -1)
+			empty -= n
+		}
+	}
+	return empty == 0
+}
+
+// emptySegmentHandler rejects requests with empty path segments captured by
+// route variables.
+func emptySegmentHandler(w http.ResponseWriter, req *http.Request) {
+	http.Error(w, "empty path segment", http.StatusBadRequest)
+}
+
+// setVars applies the variable transforms of the matched route, if any, and
+// registers the variables in the request. It returns the request to be
+// dispatched, which carries the variables in order in its context.
+func (r *Router) setVars(req *http.Request, match *mux.RouteMatch) *http.Request {
+	if r.PreserveVarSlashes {
+		for key, value := range match.Vars {
+			if v, err := url.PathUnescape(value); err == nil {
+				match.Vars[key] = v
+			}
+		}
+	}
+	m, ok := r.meta[match.Route]
+	if ok {
+		for key, f := range m.transforms {
+			if value, ok := match.Vars[key]; ok {
+				match.Vars[key] = f(value)
+			}
+		}
+	}
+	registerVars(req, match.Vars)
+	if !ok || len(m.varNames) == 0 {
+		return req
+	}
+	vars := make([]Var, 0, len(m.varNames))
+	for _, name := range m.varNames {
+		if value, ok := match.Vars[name]; ok {
+			vars = append(vars, Var{Name: name, Value: value})
+		}
+	}
+	return withVars(req, vars)
+}
+
+// varNames returns the names of the variables in pat, in order.
+func varNames(pat string) []string {
+	var names []string
+	level, start := 0, 0
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '{':
+			if level++; level == 1 {
+				start = i + 1
+			}
+		case '}':
+			if level--; level == 0 {
+				name := pat[start:i]
+				if j := strings.Index(name, ":"); j >= 0 {
+					name = name[:j]
+				}
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+	}
+	return names
 }
 
 // registerVars adds the matched route variables to the URL query.
 func registerVars(r *http.Request, vars map[string]string) {
+	if len(vars) == 0 {
+		return
+	}
 	parts, i := make([]string, len(vars)), 0
 	for key, value := range vars {
 		parts[i] = url.QueryEscape(":"+key) + "=" + url.QueryEscape(value)
@@ -123,6 +763,27 @@ func registerVars(r *http.Request, vars map[string]string) {
 	}
 }
 
+// slashPreservingPath unescapes the escaped path p, except for encoded
+// slashes and percent signs, so that the result can be split on its slashes
+// and its segments unescaped.
+func slashPreservingPath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		if p[i] == '%' && i+2 < len(p) {
+			if v, err := url.PathUnescape(p[i : i+3]); err == nil {
+				if v == "/" || v == "%" {
+					v = strings.ToUpper(p[i : i+3])
+				}
+				b.WriteString(v)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
 // cleanPath returns the canonical path for p, eliminating . and .. elements.
 // Borrowed from the net/http package.
 func cleanPath(p string) string {
@@ -6,9 +6,13 @@ package pat
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/text/unicode/norm"
 )
 
 func myHandler(w http.ResponseWriter, r *http.Request) {
@@ -63,3 +67,501 @@ func TestPatMatch(t *testing.T) {
 	testMatch(t, "GET", "/foo/x{name}", "/foo/xbar/baz", true, map[string]string{":name": "bar"})
 	testMatch(t, "PATCH", "/foo/x{name}", "/foo/xbar/baz", true, map[string]string{":name": "bar"})
 }
+
+func TestEmptySegmentVars(t *testing.T) {
+	var id string
+	var called bool
+	r := New()
+	r.Get("/users/{id}/posts", func(w http.ResponseWriter, req *http.Request) {
+		id, called = req.URL.Query().Get(":id"), true
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users//posts", nil))
+	if w.Code != http.StatusBadRequest || called {
+		t.Errorf("Expected empty segment to be rejected, got %d", w.Code)
+	}
+
+	r.AllowEmptySegmentVars = true
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users//posts", nil))
+	if w.Code != http.StatusOK || !called || id != "" {
+		t.Errorf("Expected empty segment to be captured, got %d (id: %q)", w.Code, id)
+	}
+
+	// Empty segments outside of variables are still redirected.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/1//posts", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/users/1/posts" {
+		t.Errorf("Expected redirect to cleaned path, got %d", w.Code)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	var served string
+	r1, r2 := New(), New()
+	r1.Get("/users", func(w http.ResponseWriter, req *http.Request) {
+		served = "r1"
+	})
+	r2.Get("/posts/{id}", func(w http.ResponseWriter, req *http.Request) {
+		served = "r2:" + req.URL.Query().Get(":id")
+	})
+	h := Combine(r1, r2)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/posts/42", nil))
+	if w.Code != http.StatusOK || served != "r2:42" {
+		t.Errorf("Expected second router to serve request, got %d (%q)", w.Code, served)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+func TestCombineSettings(t *testing.T) {
+	var served string
+	r1, r2 := New(), New()
+	r1.SkipCleanMethods = []string{"PROPFIND"}
+	r1.Add("PROPFIND", "/dav/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		served = "r1:" + req.URL.Path
+	}))
+	r1.Aliases = map[string]string{"/old": "/dav/"}
+	r2.MaxSegments = 2
+	r2.Get("/posts/{id}", func(w http.ResponseWriter, req *http.Request) {
+		served = "r2:" + req.URL.Query().Get(":id")
+	})
+	h := Combine(r1, r2)
+
+	tests := []struct {
+		meth, path string
+		code       int
+		served     string
+	}{
+		{"PROPFIND", "/dav//a", http.StatusOK, "r1:/dav//a"},
+		{"PROPFIND", "/old", http.StatusOK, "r1:/dav/"},
+		{"GET", "/posts//x/../42", http.StatusMovedPermanently, ""},
+		{"GET", "/posts/42", http.StatusOK, "r2:42"},
+		{"GET", "/posts/42/x/y", http.StatusRequestURITooLong, ""},
+	}
+	for _, test := range tests {
+		served = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(test.meth, test.path, nil))
+		if w.Code != test.code || served != test.served {
+			t.Errorf("%s %s: expected %d (%q), got %d (%q)", test.meth, test.path, test.code, test.served, w.Code, served)
+		}
+	}
+}
+
+func TestCombineMethods(t *testing.T) {
+	r1, r2 := New(), New()
+	r1.AutoOptions = true
+	r1.MethodNotAllowed = true
+	r1.Get("/users", func(w http.ResponseWriter, req *http.Request) {})
+	r2.Get("/posts", func(w http.ResponseWriter, req *http.Request) {})
+	h := Combine(r1, r2)
+
+	tests := []struct {
+		meth, path string
+		code       int
+	}{
+		{"OPTIONS", "/users", http.StatusNoContent},
+		{"POST", "/users", http.StatusMethodNotAllowed},
+		{"GET", "/posts", http.StatusOK},
+		{"POST", "/posts", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(test.meth, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s %s: expected %d, got %d", test.meth, test.path, test.code, w.Code)
+		}
+	}
+}
+
+func TestAddTransform(t *testing.T) {
+	var slug string
+	r := New()
+	r.AddTransform("GET", "/articles/{slug}", map[string]func(string) string{
+		"slug": strings.ToLower,
+	}, func(w http.ResponseWriter, req *http.Request) {
+		slug = req.URL.Query().Get(":slug")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/articles/Hello-World", nil))
+	if slug != "hello-world" {
+		t.Errorf("Expected transformed variable %q, got %q", "hello-world", slug)
+	}
+}
+
+func TestNormalizeUnicode(t *testing.T) {
+	var name string
+	r := New()
+	r.NormalizeUnicode = true
+	r.Get("/caf\u00e9/{name}", func(w http.ResponseWriter, req *http.Request) {
+		name = req.URL.Query().Get(":name")
+	})
+	for _, path := range []string{
+		"/caf%C3%A9/Jos%C3%A9",   // composed
+		"/cafe%CC%81/Jose%CC%81", // decomposed
+	} {
+		name = ""
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK || name != "Jos\u00e9" {
+			t.Errorf("%s: expected match with normalized variable, got %d (name: %q)", path, w.Code, name)
+		}
+	}
+}
+
+func TestExactPrecedence(t *testing.T) {
+	var served string
+	r := New()
+	r.Get("/files", func(w http.ResponseWriter, req *http.Request) {
+		served = "prefix"
+	})
+	r.Exact("GET", "/files", func(w http.ResponseWriter, req *http.Request) {
+		served = "exact"
+	})
+
+	tests := []struct {
+		path, served string
+	}{
+		{"/files", "exact"},
+		{"/files/x", "prefix"},
+	}
+	for _, test := range tests {
+		served = ""
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if served != test.served {
+			t.Errorf("%s: expected %s route, got %q", test.path, test.served, served)
+		}
+	}
+}
+
+func TestAddMany(t *testing.T) {
+	var calls int
+	r := New()
+	routes := r.AddMany("GET", []string{"/index.html", "/"}, func(w http.ResponseWriter, req *http.Request) {
+		calls++
+	})
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	for _, path := range []string{"/", "/index.html"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected handler to be called twice, got %d", calls)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	r := New()
+	r.MaxInFlight(2)
+	r.Get("/ok", myHandler)
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}()
+		<-started
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected request over the limit to be shed, got %d", w.Code)
+	}
+	close(release)
+	wg.Wait()
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected request within the limit to be served, got %d", w.Code)
+	}
+}
+
+func TestMaxInFlightConcurrent(t *testing.T) {
+	r := New()
+	r.MaxInFlight(5)
+	r.Get("/", myHandler)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := make(map[int]int)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if codes[http.StatusOK]+codes[http.StatusServiceUnavailable] != 50 {
+		t.Errorf("Expected only 200 and 503 responses, got %v", codes)
+	}
+	if r.inFlight != 0 {
+		t.Errorf("Expected no requests in flight, got %d", r.inFlight)
+	}
+}
+
+func TestSkipCleanMethods(t *testing.T) {
+	var path string
+	r := New()
+	r.SkipCleanMethods = []string{"PROPFIND"}
+	h := func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+	}
+	r.Add("PROPFIND", "/a", http.HandlerFunc(h))
+	r.Get("/a", h)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/a//b", nil))
+	if w.Code != http.StatusOK || path != "/a//b" {
+		t.Errorf("Expected raw path to be served, got %d (%q)", w.Code, path)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/a//b", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/a/b" {
+		t.Errorf("Expected redirect to cleaned path, got %d", w.Code)
+	}
+}
+
+func TestCanonicalHost(t *testing.T) {
+	var host string
+	r := New()
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		host = req.Host
+	}).Host("example.com")
+
+	tests := []struct {
+		host                 string
+		lowercase, port, dot bool
+		code                 int
+		canonical            string
+	}{
+		{"EXAMPLE.com:443", false, false, false, http.StatusNotFound, ""},
+		{"EXAMPLE.com:443", false, true, false, http.StatusNotFound, ""},
+		{"EXAMPLE.com:443", true, true, false, http.StatusOK, "example.com"},
+		{"Example.COM", true, false, false, http.StatusOK, "example.com"},
+		{"example.com:8080", false, true, false, http.StatusOK, "example.com"},
+		{"example.com.", false, false, false, http.StatusNotFound, ""},
+		{"example.com.", false, false, true, http.StatusOK, "example.com"},
+		{"Example.com.:443", true, true, true, http.StatusOK, "example.com"},
+	}
+	for _, test := range tests {
+		host = ""
+		r.LowercaseHost, r.StripHostPort, r.StripHostDot = test.lowercase, test.port, test.dot
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = test.host
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code || host != test.canonical {
+			t.Errorf("%s (lowercase: %v, strip port: %v, strip dot: %v): expected %d (%q), got %d (%q)", test.host, test.lowercase, test.port, test.dot, test.code, test.canonical, w.Code, host)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	var id string
+	r := New()
+	r.Aliases = map[string]string{"/old/42": "/new/42"}
+	r.Get("/new/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id = req.URL.Query().Get(":id")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/old/42", nil))
+	if w.Code != http.StatusOK || id != "42" {
+		t.Errorf("Expected alias to be served by the new route, got %d (id: %q)", w.Code, id)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/old/43", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a path without alias, got %d", w.Code)
+	}
+
+	r.RedirectAliases = true
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/old/42", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/new/42" {
+		t.Errorf("Expected redirect to the new path, got %d", w.Code)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	r := New()
+	r.Get("/health", myHandler)
+	r.Get("/users/{id}", myHandler)
+
+	tests := []struct {
+		on         bool
+		path       string
+		code       int
+		retryAfter bool
+	}{
+		{true, "/health", http.StatusOK, false},
+		{true, "/users/1", http.StatusServiceUnavailable, true},
+		{true, "/missing", http.StatusServiceUnavailable, true},
+		{false, "/users/1", http.StatusOK, false},
+	}
+	for _, test := range tests {
+		r.MaintenanceMode(test.on, []string{"/health"})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || (w.Header().Get("Retry-After") != "") != test.retryAfter {
+			t.Errorf("%s (maintenance: %v): expected %d, got %d", test.path, test.on, test.code, w.Code)
+		}
+	}
+}
+
+func TestRejectSmuggling(t *testing.T) {
+	r := New()
+	r.RejectSmuggling = true
+	r.Post("/upload", myHandler)
+
+	tests := []struct {
+		chunked, length bool
+		code            int
+	}{
+		{true, true, http.StatusBadRequest},
+		{true, false, http.StatusOK},
+		{false, true, http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/upload", strings.NewReader("data"))
+		if test.chunked {
+			req.TransferEncoding = []string{"chunked"}
+			req.Header.Set("Transfer-Encoding", "chunked")
+		}
+		if test.length {
+			req.Header.Set("Content-Length", "4")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("chunked: %v, content length: %v: expected %d, got %d", test.chunked, test.length, test.code, w.Code)
+		}
+	}
+}
+
+func TestPreserveVarSlashes(t *testing.T) {
+	tests := []struct {
+		preserve, normalize bool
+		path                string
+		code                int
+		q                   string
+	}{
+		{false, false, "/search/a%2Fb", http.StatusOK, "a"},
+		{true, false, "/search/a%2Fb", http.StatusOK, "a/b"},
+		{true, false, "/search/a%2F%2Fb", http.StatusOK, "a//b"},
+		{true, false, "/search/100%25%2F%41", http.StatusOK, "100%/A"},
+		{false, false, "/search/a//b", http.StatusMovedPermanently, ""},
+		{true, false, "/search/a//b", http.StatusMovedPermanently, ""},
+		{true, true, "/search/a%2Fb", http.StatusOK, "a/b"},
+		{true, true, "/search/e%CC%81%2Fb", http.StatusOK, "\u00e9/b"},
+	}
+	for _, test := range tests {
+		var q, path string
+		r := New()
+		r.PreserveVarSlashes = test.preserve
+		r.NormalizeUnicode = test.normalize
+		r.Get("/search/{q}", func(w http.ResponseWriter, req *http.Request) {
+			q, path = req.URL.Query().Get(":q"), req.URL.Path
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", test.path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s (preserve %v, normalize %v): expected %d, got %d", test.path, test.preserve, test.normalize, test.code, w.Code)
+		}
+		if q != test.q {
+			t.Errorf("%s (preserve %v, normalize %v): expected q %q, got %q", test.path, test.preserve, test.normalize, test.q, q)
+		}
+		want := req.URL.Path
+		if test.normalize {
+			want = norm.NFC.String(want)
+		}
+		if test.code == http.StatusOK && path != want {
+			t.Errorf("%s (preserve %v, normalize %v): expected handler path %q, got %q", test.path, test.preserve, test.normalize, want, path)
+		}
+	}
+}
+
+func TestAddBothSlash(t *testing.T) {
+	var id, body string
+	r := New()
+	r.AddBothSlash("GET", "/users/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id = req.URL.Query().Get(":id")
+		w.Write([]byte("user " + id))
+	})
+
+	tests := []struct {
+		path string
+		code int
+		id   string
+	}{
+		{"/users/42", http.StatusOK, "42"},
+		{"/users/42/", http.StatusOK, "42"},
+		{"/users/42/posts", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		id = ""
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code || id != test.id {
+			t.Errorf("%s: expected %d with id %q, got %d with id %q", test.path, test.code, test.id, w.Code, id)
+		}
+		if test.code == http.StatusOK {
+			if body == "" {
+				body = w.Body.String()
+			} else if w.Body.String() != body {
+				t.Errorf("%s: expected body %q, got %q", test.path, body, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestMaxSegments(t *testing.T) {
+	r := New()
+	r.MaxSegments = 3
+	r.Get("/", myHandler)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/a/b/c", http.StatusOK},
+		{"/a/b/c/", http.StatusOK},
+		{"/a/b/c/d", http.StatusRequestURITooLong},
+		{"/a/b/c/d/../", http.StatusMovedPermanently},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.path, test.code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsafeVar is returned by SafeVar for variables that are not safe to use
+// as a file name.
+var ErrUnsafeVar = errors.New("pat: unsafe route variable")
+
+// SafeVar returns the named route variable of the request if it is safe to
+// use as a single element of a file system path. Values that are, or decode
+// to, "." or "..", or that contain slashes, backslashes or NUL characters,
+// are rejected with ErrUnsafeVar. Values that do not decode, such as "100%",
+// are only checked as is.
+func SafeVar(r *http.Request, name string) (string, error) {
+	value := r.URL.Query().Get(":" + name)
+	for _, v := range OrderedVars(r) {
+		if v.Name == name {
+			value = v.Value
+			break
+		}
+	}
+	checked := []string{value}
+	if decoded, err := url.PathUnescape(value); err == nil {
+		checked = append(checked, decoded)
+	}
+	for _, s := range checked {
+		if s == "." || s == ".." || strings.ContainsAny(s, "/\\\x00") {
+			return "", ErrUnsafeVar
+		}
+	}
+	return value, nil
+}
+
+// Pagination returns the offset and limit given by the "offset" and "limit"
+// query parameters of the request, which default to 0 and defaultLimit. The
+// limit is clamped to maxLimit, if positive. Route variables are not
+// considered, since they are injected in the query with a ":" prefix.
+// Negative or non-numeric values are rejected with a descriptive error.
+func Pagination(r *http.Request, defaultLimit, maxLimit int) (offset, limit int, err error) {
+	query := r.URL.Query()
+	if offset, err = queryInt(query, "offset", 0); err != nil {
+		return 0, 0, err
+	}
+	if limit, err = queryInt(query, "limit", defaultLimit); err != nil {
+		return 0, 0, err
+	}
+	if maxLimit > 0 && limit > maxLimit {
+		limit = maxLimit
+	}
+	return offset, limit, nil
+}
+
+// queryInt returns the non-negative integer value of the named query
+// parameter, or def if it is absent or empty.
+func queryInt(query url.Values, name string, def int) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("pat: invalid %s %q: must be a non-negative integer", name, s)
+	}
+	return n, nil
+}
+
+// BufferBody reads the whole body of the request and replaces it with a fresh
+// reader over the same bytes, so that it can be read again, e.g. by several
+// middleware and then the handler. If the body was already buffered, the
+// buffered bytes are returned without reading, even if partially consumed.
+//
+// BufferBody reads bodies of any size; set the router's BufferBodyLimit to
+// buffer bodies up to a limit before matching.
+func BufferBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	if b, ok := r.Body.(*bufferedBody); ok {
+		r.Body = newBufferedBody(b.data)
+		return b.data, nil
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = newBufferedBody(data)
+	return data, nil
+}
+
+// bufferedBody is a request body read from memory.
+type bufferedBody struct {
+	*bytes.Reader
+	data []byte
+}
+
+// newBufferedBody returns a body reading data from the start.
+func newBufferedBody(data []byte) *bufferedBody {
+	return &bufferedBody{Reader: bytes.NewReader(data), data: data}
+}
+
+// Close does nothing.
+func (b *bufferedBody) Close() error {
+	return nil
+}
+
+// countingBody is a request body that counts the bytes read from it.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+// Read reads from the body and counts the bytes read.
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// remoteIP returns the host part of the request's RemoteAddr.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedIP returns the first, client-most, address of the request's
+// X-Forwarded-For header, or "" if there is none.
+func forwardedIP(r *http.Request) string {
+	fwd := r.Header.Get("X-Forwarded-For")
+	if i := strings.IndexByte(fwd, ','); i >= 0 {
+		fwd = fwd[:i]
+	}
+	return strings.TrimSpace(fwd)
+}
@@ -0,0 +1,112 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSafeVar(t *testing.T) {
+	var name string
+	var err error
+	r := New()
+	r.Get("/files/{name:.+}", func(w http.ResponseWriter, req *http.Request) {
+		name, err = SafeVar(req, "name")
+	})
+
+	tests := []struct {
+		path, name string
+		ok         bool
+	}{
+		{"/files/report.pdf", "report.pdf", true},
+		{"/files/a..b", "a..b", true},
+		{"/files/%252E%252E", "", false},
+		{"/files/a%252Fb", "", false},
+		{"/files/a%5Cb", "", false},
+		{"/files/100%25", "100%", true},
+		{"/files/100%25%252E", "100%%2E", true},
+	}
+	for _, test := range tests {
+		name, err = "", nil
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if (err == nil) != test.ok || name != test.name {
+			t.Errorf("%s: expected (%q, ok: %v), got (%q, %v)", test.path, test.name, test.ok, name, err)
+		}
+	}
+
+	// Dot segments in the path are cleaned before matching, but variables
+	// registered in the query by other means are checked as well.
+	if _, err := SafeVar(httptest.NewRequest("GET", "/?:name=..", nil), "name"); err != ErrUnsafeVar {
+		t.Errorf("Expected ErrUnsafeVar for \"..\", got %v", err)
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	var reads []string
+	read := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := BufferBody(req)
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			reads = append(reads, string(body))
+			h.ServeHTTP(w, req)
+		})
+	}
+	r := New()
+	r.BufferBodyLimit = 16
+	r.Use(read, read)
+	r.Post("/hooks", func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		reads = append(reads, string(body))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/hooks", strings.NewReader("payload")))
+	if w.Code != http.StatusOK || strings.Join(reads, ",") != "payload,payload,payload" {
+		t.Errorf("Expected every reader to see the body, got %d (%q)", w.Code, reads)
+	}
+
+	reads = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/hooks", strings.NewReader("a 16-byte bodyyy")))
+	if w.Code != http.StatusOK || len(reads) != 3 {
+		t.Errorf("Expected a body at the limit to be served, got %d", w.Code)
+	}
+
+	reads = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/hooks", strings.NewReader("a payload over the limit")))
+	if w.Code != http.StatusRequestEntityTooLarge || reads != nil {
+		t.Errorf("Expected 413 for a body over the limit, got %d", w.Code)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		url           string
+		offset, limit int
+		ok            bool
+	}{
+		{"/items", 0, 20, true},
+		{"/items?offset=40&limit=10", 40, 10, true},
+		{"/items?limit=500", 0, 100, true},
+		{"/items?:offset=5&:limit=5", 0, 20, true},
+		{"/items?offset=-1", 0, 0, false},
+		{"/items?limit=ten", 0, 0, false},
+		{"/items?limit=-5", 0, 0, false},
+	}
+	for _, test := range tests {
+		offset, limit, err := Pagination(httptest.NewRequest("GET", test.url, nil), 20, 100)
+		if (err == nil) != test.ok || offset != test.offset || limit != test.limit {
+			t.Errorf("%s: expected (%d, %d, ok: %v), got (%d, %d, %v)", test.url, test.offset, test.limit, test.ok, offset, limit, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps the http.ResponseWriter passed to handlers by the
+// router, applying response defaults and recording the status code.
+type responseWriter struct {
+	http.ResponseWriter
+	// contentType is set when the response has no Content-Type.
+	contentType string
+	status      int
+	// written is the number of body bytes written.
+	written int64
+}
+
+// WriteHeader sends the response header with the given status code.
+func (w *responseWriter) WriteHeader(status int) {
+	w.setStatus(status)
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes p to the response body, sending the header first if needed.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.setStatus(http.StatusOK)
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// setStatus records the status code of the response, applying the defaults
+// to the header before it is sent.
+func (w *responseWriter) setStatus(status int) {
+	if w.status != 0 || status < 200 {
+		return
+	}
+	w.status = status
+	if w.contentType != "" && bodyAllowed(status) {
+		if _, ok := w.Header()["Content-Type"]; !ok {
+			w.Header().Set("Content-Type", w.contentType)
+		}
+	}
+}
+
+// Flush sends any buffered data to the client, if supported.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, if supported.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("pat: response does not implement http.Hijacker")
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// bodyAllowed reports whether a response with the given status may have a
+// body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// MaxBufferedResponse is the maximum size of a response body buffered by
+// BufferedResponse. Changing it only affects the handlers returned afterwards.
+var MaxBufferedResponse = 4 << 20
+
+// errBufferFull is returned when writing past the limit of a responseBuffer.
+var errBufferFull = errors.New("pat: response buffer is full")
+
+// BufferedResponse returns a handler that buffers the whole response of h in
+// memory and only sends it once h returns, so that clients never get a
+// partial response: if h panics, nothing is sent. Bodies larger than
+// MaxBufferedResponse, as set when BufferedResponse is called, are replaced
+// by a 500 Internal Server Error.
+func BufferedResponse(h http.HandlerFunc) http.HandlerFunc {
+	max := MaxBufferedResponse
+	return func(w http.ResponseWriter, req *http.Request) {
+		b := newResponseBuffer()
+		b.max = max
+		h(b, req)
+		if b.full {
+			http.Error(w, "response too large", http.StatusInternalServerError)
+			return
+		}
+		b.writeTo(w)
+	}
+}
+
+// responseBuffer is an http.ResponseWriter that keeps the response in memory
+// so that it can be written later, possibly more than once.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	// max is the size limit of the body, if positive; full is set when a
+	// write goes past it.
+	max  int
+	full bool
+}
+
+// newResponseBuffer returns an empty responseBuffer.
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+// Header returns the header map of the buffered response.
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader records the status code of the buffered response.
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// Write appends p to the body of the buffered response.
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	if b.max > 0 && b.body.Len()+len(p) > b.max {
+		b.full = true
+		return 0, errBufferFull
+	}
+	return b.body.Write(p)
+}
+
+// writeTo writes the buffered response to w.
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDefaultContentType(t *testing.T) {
+	r := New()
+	r.Get("/json", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	r.Get("/text", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("{}"))
+	})
+
+	tests := []struct {
+		def, path, contentType string
+	}{
+		{"", "/json", "text/plain; charset=utf-8"},
+		{"application/json", "/json", "application/json"},
+		{"application/json", "/text", "text/plain"},
+	}
+	for _, test := range tests {
+		r.DefaultContentType = test.def
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%s (default %q): expected Content-Type %q, got %q", test.path, test.def, test.contentType, ct)
+		}
+	}
+}
+
+func TestOnError(t *testing.T) {
+	var route string
+	var status int
+	r := New()
+	r.OnError = func(rt string, st int, req *http.Request) {
+		route, status = rt, st
+	}
+	r.Get("/fail/{id}", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "failed", http.StatusInternalServerError)
+	})
+	r.Get("/ok", myHandler)
+
+	tests := []struct {
+		path, route string
+		status      int
+	}{
+		{"/missing", "", http.StatusNotFound},
+		{"/fail/1", "/fail/{id}", http.StatusInternalServerError},
+		{"/ok", "", 0},
+	}
+	for _, test := range tests {
+		route, status = "", 0
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", test.path, nil))
+		if route != test.route || status != test.status {
+			t.Errorf("%s: expected callback with (%q, %d), got (%q, %d)", test.path, test.route, test.status, route, status)
+		}
+	}
+
+	// Responses sent before matching are reported as well.
+	r.MaxSegments = 3
+	r.BufferBodyLimit = 4
+	for _, test := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/a/b/c/d", "", http.StatusRequestURITooLong},
+		{"/ok", "too large", http.StatusRequestEntityTooLarge},
+	} {
+		route, status = "", 0
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", test.path, strings.NewReader(test.body)))
+		if status != test.status {
+			t.Errorf("POST %s: expected callback with status %d, got %d", test.path, test.status, status)
+		}
+	}
+}
+
+func TestBufferedResponse(t *testing.T) {
+	r := New()
+	r.Get("/ok", BufferedResponse(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Test", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("complete"))
+	}))
+	r.Get("/panic", BufferedResponse(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("partial"))
+		panic("late failure")
+	}))
+	r.Get("/large", BufferedResponse(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(make([]byte, MaxBufferedResponse+1))
+	}))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	if w.Code != http.StatusCreated || w.Header().Get("X-Test") != "1" || w.Body.String() != "complete" {
+		t.Errorf("Expected buffered response to be sent, got %d (%q)", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected panic to propagate")
+			}
+		}()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	}()
+	if w.Flushed || w.Body.Len() != 0 {
+		t.Errorf("Expected no partial body, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/large", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 for oversized response, got %d", w.Code)
+	}
+}
+
+func TestBufferedResponseLimit(t *testing.T) {
+	max := MaxBufferedResponse
+	MaxBufferedResponse = 4
+	h := BufferedResponse(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("too large"))
+	})
+	MaxBufferedResponse = max
+
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the limit set at creation to apply, got %d", w.Code)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Methods []string `json:"methods"`
+	Pattern string   `json:"pattern"`
+	Name    string   `json:"name,omitempty"`
+}
+
+// Routes returns the registered routes in the order they are matched.
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		pattern, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		routes = append(routes, RouteInfo{
+			Methods: methods,
+			Pattern: pattern,
+			Name:    route.GetName(),
+		})
+		return nil
+	})
+	return routes
+}
+
+// DebugRoutes registers a GET endpoint at path that serves the route table,
+// as returned by Routes, encoded as JSON.
+//
+// The endpoint is a regular route, so it runs behind the router's
+// middleware; use it (or a matcher on the returned route) to protect it.
+func (r *Router) DebugRoutes(path string) *mux.Route {
+	return r.Get(path, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Routes())
+	})
+}
+
+// AllowedMethods returns the request methods of the routes matching the
+// given path, in registration order. Prefix routes report their methods for
+// every path under their prefix, while exact routes only do so for their
+// whole path.
+func (r *Router) AllowedMethods(path string) []string {
+	return r.allowedMethods(&http.Request{
+		URL:    &url.URL{Path: path},
+		Header: make(http.Header),
+	})
+}
+
+// allowedMethods returns the request methods of the routes matching req,
+// regardless of its own method. HEAD is included for GET routes if AutoHead
+// is set.
+func (r *Router) allowedMethods(req *http.Request) []string {
+	var methods []string
+	seen := make(map[string]bool)
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		meths, _ := route.GetMethods()
+		for _, meth := range meths {
+			if seen[meth] {
+				continue
+			}
+			mreq := *req
+			mreq.Method = meth
+			if route.Match(&mreq, &mux.RouteMatch{}) {
+				seen[meth] = true
+				methods = append(methods, meth)
+			}
+		}
+		return nil
+	})
+	if r.AutoHead && seen["GET"] && !seen["HEAD"] {
+		methods = append(methods, "HEAD")
+	}
+	return methods
+}
+
+// optionsHandler returns a handler that answers an OPTIONS request with the
+// given allowed methods. CORS preflight requests also get them in the
+// Access-Control-Allow-Methods header; the other CORS headers are left to the
+// application.
+func optionsHandler(methods []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		allowed := strings.Join(methods, ", ")
+		w.Header().Set("Allow", allowed+", OPTIONS")
+		if req.Header.Get("Origin") != "" && req.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", allowed)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// URLBuilder looks up the named route once and returns a function that builds
+// its URL from pairs of variable names and values, as the route's URL method
+// does. It is meant for templates rendering many links to the same route.
+func (r *Router) URLBuilder(name string) (func(pairs ...string) (string, error), error) {
+	route := r.GetRoute(name)
+	if route == nil {
+		return nil, fmt.Errorf("pat: no route named %q", name)
+	}
+	return func(pairs ...string) (string, error) {
+		u, err := route.URL(pairs...)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}, nil
+}
+
+// methodNotAllowedHandler returns a handler that responds with a 405 Method
+// Not Allowed listing the given allowed methods.
+func methodNotAllowedHandler(methods []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	})
+}
+
+// OpenAPIPaths returns a skeletal OpenAPI "paths" object for the registered
+// routes, to jump-start API documentation. Paths are keyed by template, with
+// variables in OpenAPI "{name}" form, and map lowercase methods to operations
+// declaring the path parameters and a default response.
+func (r *Router) OpenAPIPaths() map[string]map[string]interface{} {
+	paths := make(map[string]map[string]interface{})
+	for _, route := range r.Routes() {
+		if route.Pattern == "" || len(route.Methods) == 0 {
+			continue
+		}
+		path, names := openAPIPath(route.Pattern)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		for _, meth := range route.Methods {
+			op := map[string]interface{}{
+				"responses": map[string]interface{}{
+					"default": map[string]interface{}{"description": "Default response"},
+				},
+			}
+			if route.Name != "" {
+				op["operationId"] = route.Name
+			}
+			if len(names) > 0 {
+				params := make([]interface{}, len(names))
+				for i, name := range names {
+					params[i] = map[string]interface{}{
+						"name":     name,
+						"in":       "path",
+						"required": true,
+						"schema":   map[string]interface{}{"type": "string"},
+					}
+				}
+				op["parameters"] = params
+			}
+			paths[path][strings.ToLower(meth)] = op
+		}
+	}
+	return paths
+}
+
+// openAPIPath converts a route template to an OpenAPI path template, turning
+// "{name:pattern}" and ":name" segments into "{name}". It also returns the
+// variable names, in order.
+func openAPIPath(tpl string) (string, []string) {
+	var names []string
+	segments := strings.Split(tpl, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") && len(seg) > 1 {
+			names = append(names, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+			continue
+		}
+		if vars := varNames(seg); len(vars) > 0 {
+			names = append(names, vars...)
+			var b strings.Builder
+			level := 0
+			for j := 0; j < len(seg); j++ {
+				switch c := seg[j]; {
+				case c == '{':
+					if level++; level == 1 {
+						b.WriteString("{" + vars[0] + "}")
+						vars = vars[1:]
+					}
+				case c == '}':
+					level--
+				case level == 0:
+					b.WriteByte(c)
+				}
+			}
+			segments[i] = b.String()
+		}
+	}
+	return strings.Join(segments, "/"), names
+}
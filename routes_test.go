@@ -0,0 +1,242 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	r := New()
+	r.DebugRoutes("/debug/routes")
+	r.Get("/products/{key}", myHandler).Name("product")
+	r.Post("/products", myHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug/routes", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	var routes []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("Invalid route table: %v", err)
+	}
+	expected := []RouteInfo{
+		{Methods: []string{"GET"}, Pattern: "/debug/routes"},
+		{Methods: []string{"GET"}, Pattern: "/products/{key}", Name: "product"},
+		{Methods: []string{"POST"}, Pattern: "/products"},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected routes %v, got %v", expected, routes)
+	}
+}
+
+func TestAutoOptions(t *testing.T) {
+	r := New()
+	r.AutoOptions = true
+	r.Get("/users", myHandler)
+	r.Post("/users", myHandler)
+	r.Get("/posts", myHandler)
+	r.Delete("/posts", myHandler)
+
+	tests := []struct {
+		path, methods string
+	}{
+		{"/users", "GET, POST"},
+		{"/posts", "GET, DELETE"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("OPTIONS", test.path, nil)
+		req.Header.Set("Origin", "http://example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d", test.path, w.Code)
+		}
+		if m := w.Header().Get("Access-Control-Allow-Methods"); m != test.methods {
+			t.Errorf("%s: expected allowed methods %q, got %q", test.path, test.methods, m)
+		}
+		if m := w.Header().Get("Allow"); m != test.methods+", OPTIONS" {
+			t.Errorf("%s: expected Allow %q, got %q", test.path, test.methods+", OPTIONS", m)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown path, got %d", w.Code)
+	}
+}
+
+func TestAutoOptionsPrefix(t *testing.T) {
+	r := New()
+	r.AutoOptions = true
+	r.Get("/files", myHandler)
+	r.Put("/files", myHandler)
+	r.Exact("DELETE", "/files", myHandler)
+
+	tests := []struct {
+		path, allow string
+	}{
+		{"/files/a/b", "GET, PUT, OPTIONS"},
+		{"/files", "GET, PUT, DELETE, OPTIONS"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("OPTIONS", test.path, nil))
+		if w.Code != http.StatusNoContent || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s: expected 204 with Allow %q, got %d (%q)", test.path, test.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestURLBuilder(t *testing.T) {
+	r := New()
+	r.Get("/articles/{category}/{id:[0-9]+}", myHandler).Name("article")
+
+	build, err := r.URLBuilder("article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pairs := range [][]string{
+		{"category", "go", "id", "1"},
+		{"category", "web", "id", "42"},
+	} {
+		got, err := build(pairs...)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", pairs, err)
+			continue
+		}
+		u, _ := r.GetRoute("article").URL(pairs...)
+		if got != u.String() {
+			t.Errorf("%v: expected %q, got %q", pairs, u.String(), got)
+		}
+	}
+	if _, err := build("category", "go", "id", "x"); err == nil {
+		t.Errorf("Expected error for invalid variable")
+	}
+	if _, err := r.URLBuilder("missing"); err == nil {
+		t.Errorf("Expected error for unknown route")
+	}
+}
+
+func TestAutoHead(t *testing.T) {
+	var served bool
+	r := New()
+	r.MethodNotAllowed = true
+	r.Post("/items", myHandler)
+	r.Get("/docs", func(w http.ResponseWriter, req *http.Request) {
+		served = true
+	})
+
+	tests := []struct {
+		autoHead    bool
+		path        string
+		code        int
+		allow       string
+		servedByGet bool
+	}{
+		{true, "/items", http.StatusMethodNotAllowed, "POST", false},
+		{true, "/docs", http.StatusOK, "", true},
+		{false, "/items", http.StatusMethodNotAllowed, "POST", false},
+		{false, "/docs", http.StatusMethodNotAllowed, "GET", false},
+		{true, "/missing", http.StatusNotFound, "", false},
+	}
+	for _, test := range tests {
+		served = false
+		r.AutoHead = test.autoHead
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("HEAD", test.path, nil))
+		if w.Code != test.code || w.Header().Get("Allow") != test.allow || served != test.servedByGet {
+			t.Errorf("HEAD %s (auto head: %v): expected %d (Allow %q), got %d (Allow %q)", test.path, test.autoHead, test.code, test.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+
+	r.AutoHead = true
+	if methods := r.AllowedMethods("/docs"); !reflect.DeepEqual(methods, []string{"GET", "HEAD"}) {
+		t.Errorf("Expected GET and HEAD to be allowed, got %v", methods)
+	}
+	if methods := r.AllowedMethods("/items"); !reflect.DeepEqual(methods, []string{"POST"}) {
+		t.Errorf("Expected only POST to be allowed, got %v", methods)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.Get("/", myHandler)
+
+	for _, enabled := range []bool{false, true} {
+		r.MethodNotAllowed = enabled
+		code, allow := http.StatusNotFound, ""
+		if enabled {
+			code, allow = http.StatusMethodNotAllowed, "GET"
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/anything", nil))
+		if w.Code != code || w.Header().Get("Allow") != allow {
+			t.Errorf("POST /anything (method not allowed: %v): expected %d (Allow %q), got %d (Allow %q)", enabled, code, allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	r := New()
+	r.Get("/users", myHandler)
+	r.Post("/users", myHandler)
+	r.Get("/users/{id:[0-9]+}/posts/{slug}", myHandler).Name("userPost")
+
+	paths := r.OpenAPIPaths()
+	if len(paths) != 2 {
+		t.Errorf("Expected 2 paths, got %v", paths)
+	}
+	if _, ok := paths["/users"]["get"]; !ok {
+		t.Errorf("Expected GET /users, got %v", paths["/users"])
+	}
+	if _, ok := paths["/users"]["post"]; !ok {
+		t.Errorf("Expected POST /users, got %v", paths["/users"])
+	}
+	op, ok := paths["/users/{id}/posts/{slug}"]["get"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected GET /users/{id}/posts/{slug}, got %v", paths)
+	}
+	if op["operationId"] != "userPost" {
+		t.Errorf("Expected operationId %q, got %v", "userPost", op["operationId"])
+	}
+	params, _ := op["parameters"].([]interface{})
+	var names []string
+	for _, p := range params {
+		p := p.(map[string]interface{})
+		if p["in"] != "path" || p["required"] != true {
+			t.Errorf("Expected required path parameter, got %v", p)
+		}
+		names = append(names, p["name"].(string))
+	}
+	if !reflect.DeepEqual(names, []string{"id", "slug"}) {
+		t.Errorf("Expected parameters id and slug, got %v", names)
+	}
+	if _, ok := paths["/users"]["get"].(map[string]interface{})["parameters"]; ok {
+		t.Errorf("Expected no parameters for /users")
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		tpl, path string
+	}{
+		{"/users/{id}", "/users/{id}"},
+		{"/users/{id:[0-9]{1,3}}/x{name}", "/users/{id}/x{name}"},
+		{"/users/:id", "/users/{id}"},
+	}
+	for _, test := range tests {
+		if path, _ := openAPIPath(test.tpl); path != test.path {
+			t.Errorf("%s: expected %q, got %q", test.tpl, test.path, path)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Static registers a handler for GET requests that serves the files in the
+// directory dir under the given path prefix.
+//
+// Files are served by http.FileServer, which handles conditional and range
+// requests (206 Partial Content).
+func (r *Router) Static(prefix, dir string) *mux.Route {
+	return r.StaticFS(prefix, http.Dir(dir))
+}
+
+// StaticFS registers a handler for GET requests that serves the files in fs
+// under the given path prefix.
+func (r *Router) StaticFS(prefix string, fs http.FileSystem) *mux.Route {
+	return r.Add("GET", prefix, http.StripPrefix(prefix, http.FileServer(fs)))
+}
+
+// File registers a handler for GET requests that serves the named file.
+//
+// The file is served by http.ServeFile, which handles conditional and range
+// requests (206 Partial Content).
+func (r *Router) File(pat, name string) *mux.Route {
+	return r.Get(pat, func(w http.ResponseWriter, req *http.Request) {
+		http.ServeFile(w, req, name)
+	})
+}
+
+// SPA serves a single-page application from staticDir on requests that match
+// no route: existing files are served as is, and GET and HEAD requests
+// accepting text/html explicitly are given indexFile with a 200 OK, so that
+// client-side routes can be loaded directly. Other requests, such as API calls
+// to unknown paths, are left to the previous NotFoundHandler.
+//
+// SPA replaces the router's NotFoundHandler, so it must be called after the
+// NotFoundHandler is set, if ever.
+func (r *Router) SPA(staticDir http.FileSystem, indexFile string) {
+	notFound := r.NotFoundHandler
+	if notFound == nil {
+		notFound = http.NotFoundHandler()
+	}
+	files := http.FileServer(staticDir)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			notFound.ServeHTTP(w, req)
+			return
+		}
+		if isFile(staticDir, path.Clean("/"+req.URL.Path)) {
+			files.ServeHTTP(w, req)
+			return
+		}
+		if !acceptsHTML(req) {
+			notFound.ServeHTTP(w, req)
+			return
+		}
+		f, err := staticDir.Open(path.Clean("/" + indexFile))
+		if err != nil {
+			notFound.ServeHTTP(w, req)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			notFound.ServeHTTP(w, req)
+			return
+		}
+		http.ServeContent(w, req, fi.Name(), fi.ModTime(), f)
+	})
+}
+
+// isFile reports whether name is a regular file of fs.
+func isFile(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	return err == nil && !fi.IsDir()
+}
+
+// acceptsHTML reports whether the Accept header of the request explicitly
+// lists text/html. Wildcards do not count, so that API clients sending
+// "*/*" still get their 404s.
+func acceptsHTML(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err == nil && mediaRange == "text/html" && params["q"] != "0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "hello.txt")
+	if err := ioutil.WriteFile(name, []byte("hello, world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.Static("/static", dir)
+	r.StaticFS("/fs", http.Dir(dir))
+	r.File("/hello", name)
+
+	for _, path := range []string{"/static/hello.txt", "/fs/hello.txt", "/hello"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Range", "bytes=0-4")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusPartialContent {
+			t.Errorf("%s: expected 206, got %d", path, w.Code)
+		}
+		if cr := w.Header().Get("Content-Range"); cr != "bytes 0-4/12" {
+			t.Errorf("%s: expected Content-Range %q, got %q", path, "bytes 0-4/12", cr)
+		}
+		if body := w.Body.String(); body != "hello" {
+			t.Errorf("%s: expected partial body %q, got %q", path, "hello", body)
+		}
+	}
+}
+
+func TestSPA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>app</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("run()"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.Get("/api/users", myHandler)
+	r.SPA(http.Dir(dir), "index.html")
+
+	tests := []struct {
+		path   string
+		accept string
+		code   int
+		body   string
+	}{
+		{"/app.js", "*/*", http.StatusOK, "run()"},
+		{"/dashboard/settings", "text/html,application/xhtml+xml,*/*;q=0.8", http.StatusOK, "<html>app</html>"},
+		{"/dashboard/settings", "*/*", http.StatusNotFound, "404 page not found\n"},
+		{"/api/missing", "application/json", http.StatusNotFound, "404 page not found\n"},
+		{"/api/users", "text/html", http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s (Accept %q): expected %d, got %d", test.path, test.accept, test.code, w.Code)
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("%s (Accept %q): expected body %q, got %q", test.path, test.accept, test.body, body)
+		}
+	}
+}
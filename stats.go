@@ -0,0 +1,99 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// reservoirSize is the number of latency samples kept per route.
+const reservoirSize = 1024
+
+// Stats summarizes the latencies of the requests served by a route. The
+// percentiles are estimated from a fixed-size random sample of them.
+type Stats struct {
+	Count         int64
+	P50, P95, P99 time.Duration
+}
+
+// RouteStats returns the latency statistics of the routes with the given
+// pattern, collected while CollectStats is set.
+func (r *Router) RouteStats(pattern string) Stats {
+	r.statsMu.Lock()
+	res := r.stats[pattern]
+	r.statsMu.Unlock()
+	if res == nil {
+		return Stats{}
+	}
+	return res.stats()
+}
+
+// observe records the latency of a request served by the routes with the
+// given pattern.
+func (r *Router) observe(pattern string, d time.Duration) {
+	r.statsMu.Lock()
+	if r.stats == nil {
+		r.stats = make(map[string]*reservoir)
+	}
+	res := r.stats[pattern]
+	if res == nil {
+		res = &reservoir{}
+		r.stats[pattern] = res
+	}
+	r.statsMu.Unlock()
+	res.add(d)
+}
+
+// reservoir is a uniform random sample of latencies, of bounded size.
+type reservoir struct {
+	mu      sync.Mutex
+	count   int64
+	samples []time.Duration
+}
+
+// add offers d to the sample.
+func (res *reservoir) add(d time.Duration) {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	res.count++
+	if len(res.samples) < reservoirSize {
+		res.samples = append(res.samples, d)
+	} else if i := rand.Int63n(res.count); i < reservoirSize {
+		res.samples[i] = d
+	}
+}
+
+// stats returns the statistics estimated from the sample.
+func (res *reservoir) stats() Stats {
+	res.mu.Lock()
+	samples := append([]time.Duration(nil), res.samples...)
+	count := res.count
+	res.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return Stats{
+		Count: count,
+		P50:   percentile(samples, 50),
+		P95:   percentile(samples, 95),
+		P99:   percentile(samples, 99),
+	}
+}
+
+// percentile returns the p-th percentile of the sorted samples, using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return sorted[i]
+}
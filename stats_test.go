@@ -0,0 +1,60 @@
+// Copyright 2012 The Gorilla Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pat
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouteStats(t *testing.T) {
+	r := New()
+	// Small samples are kept whole, so percentiles are exact.
+	for i := 1; i <= 1000; i++ {
+		r.observe("/exact", time.Duration(i)*time.Millisecond)
+	}
+	// Large samples are estimated from the reservoir.
+	for i := 0; i < 100000; i++ {
+		r.observe("/sampled", time.Duration(i%1000+1)*time.Millisecond)
+	}
+
+	tests := []struct {
+		pattern       string
+		count         int64
+		p50, p95, p99 time.Duration
+		tolerance     time.Duration
+	}{
+		{"/exact", 1000, 500 * time.Millisecond, 950 * time.Millisecond, 990 * time.Millisecond, 0},
+		{"/sampled", 100000, 500 * time.Millisecond, 950 * time.Millisecond, 990 * time.Millisecond, 100 * time.Millisecond},
+	}
+	within := func(got, expected, tolerance time.Duration) bool {
+		return got >= expected-tolerance && got <= expected+tolerance
+	}
+	for _, test := range tests {
+		s := r.RouteStats(test.pattern)
+		if s.Count != test.count {
+			t.Errorf("%s: expected count %d, got %d", test.pattern, test.count, s.Count)
+		}
+		if !within(s.P50, test.p50, test.tolerance) || !within(s.P95, test.p95, test.tolerance) || !within(s.P99, test.p99, test.tolerance) {
+			t.Errorf("%s: expected percentiles %v/%v/%v (±%v), got %v/%v/%v", test.pattern, test.p50, test.p95, test.p99, test.tolerance, s.P50, s.P95, s.P99)
+		}
+	}
+}
+
+func TestCollectStats(t *testing.T) {
+	r := New()
+	r.CollectStats = true
+	r.Get("/users/{id}", myHandler)
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+	}
+	if s := r.RouteStats("/users/{id}"); s.Count != 3 {
+		t.Errorf("Expected 3 requests recorded, got %d", s.Count)
+	}
+	if s := r.RouteStats("/missing"); s != (Stats{}) {
+		t.Errorf("Expected no stats for unknown pattern, got %v", s)
+	}
+}